@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -16,12 +17,22 @@ import (
 	"github.com/aws-samples/aws-pod-eip-controller/pkg/handler"
 	"github.com/aws-samples/aws-pod-eip-controller/pkg/k8s"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
-	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// warmPoolMaintainPeriod is how often warm pools are filled up to the minimum size and expired addresses are released
+	warmPoolMaintainPeriod = time.Minute
+	// parkedMaintainPeriod is how often parked addresses whose retain period has expired are released
+	parkedMaintainPeriod = time.Minute
+	// workloadCollectPeriod is how often the addresses of scaled down or deleted workloads are released
+	workloadCollectPeriod = time.Minute
 )
 
 func main() {
@@ -35,6 +46,10 @@ func main() {
 		os.Exit(1)
 	}
 
+	if flags.MetricsAddress != "" {
+		pkg.ServeMetrics(logger, flags.MetricsAddress)
+	}
+
 	restConfig, err := getRestConfig(logger, flags.Kubeconfig)
 	if err != nil {
 		logger.Error(fmt.Sprintf("get rest config: %v", err))
@@ -47,50 +62,96 @@ func main() {
 		os.Exit(1)
 	}
 
-	ec2Client, err := aws.NewEC2Client(logger, flags.Region, flags.VpcID, flags.ClusterName)
+	ec2Client, err := aws.NewEC2Client(logger, aws.EC2ClientConfig{
+		Region:                   flags.Region,
+		VpcID:                    flags.VpcID,
+		ClusterName:              flags.ClusterName,
+		AssociationVerifyTimeout: time.Duration(flags.AssociationVerifyTimeout) * time.Second,
+		ReplaceForeignAddresses:  flags.ReplaceForeignAddresses,
+		DescribeRateLimit:        aws.RateLimit{QPS: float32(flags.EC2DescribeQPS), Burst: flags.EC2DescribeBurst},
+		MutateRateLimit:          aws.RateLimit{QPS: float32(flags.EC2MutateQPS), Burst: flags.EC2MutateBurst},
+		CallTimeout:              time.Duration(flags.EC2CallTimeout) * time.Second,
+		StickyRetainPeriod:       time.Duration(flags.StickyRetainPeriod) * time.Second,
+		WarmPool: aws.WarmPoolConfig{
+			Pools:   flags.WarmPoolIDs(),
+			MinSize: flags.WarmPoolMinSize,
+			MaxSize: flags.WarmPoolMaxSize,
+			TTL:     time.Duration(flags.WarmPoolTTL) * time.Second,
+		},
+	})
 	if err != nil {
 		logger.Error(fmt.Sprintf("new ec2 client: %v", err))
 		os.Exit(1)
 	}
 
-	if err := run(logger, clientset, ec2Client, k8s.PodControllerConfig{
-		Namespace:    flags.WatchNamespace,
-		ResyncPeriod: time.Duration(flags.ResyncPeriod) * time.Second,
+	ctx := getStopContext(logger)
+	if len(flags.WarmPoolIDs()) > 0 {
+		go wait.UntilWithContext(ctx, ec2Client.MaintainWarmPools, warmPoolMaintainPeriod)
+	}
+	if flags.StickyRetainPeriod > 0 {
+		go wait.UntilWithContext(ctx, ec2Client.MaintainParkedAddresses, parkedMaintainPeriod)
+	}
+
+	kubeCallTimeout := time.Duration(flags.KubeCallTimeout) * time.Second
+	workloadCollector := handler.NewWorkloadCollector(logger, clientset.AppsV1(), ec2Client, kubeCallTimeout)
+	go wait.UntilWithContext(ctx, workloadCollector.Collect, workloadCollectPeriod)
+
+	if err := run(ctx, logger, clientset, ec2Client, kubeCallTimeout, k8s.PodControllerConfig{
+		Namespaces:             flags.WatchNamespaces(),
+		ExcludeNamespaces:      flags.ExcludedNamespaces(),
+		ResyncPeriod:           time.Duration(flags.ResyncPeriod) * time.Second,
+		PodLabelSelector:       flags.PodLabelSelector,
+		PodFieldSelector:       flags.PodFieldSelector,
+		NamespaceLabelSelector: flags.NamespaceLabelSelector,
+		PendingPollPeriod:      time.Duration(flags.PendingPollPeriod) * time.Second,
+		DeadLetterBaseDelay:    time.Duration(flags.DeadLetterBaseDelay) * time.Second,
+		DeadLetterMaxDelay:     time.Duration(flags.DeadLetterMaxDelay) * time.Second,
+		QueueBaseDelay:         time.Duration(flags.QueueBaseDelay) * time.Millisecond,
+		QueueMaxDelay:          time.Duration(flags.QueueMaxDelay) * time.Second,
+		QueueQPS:               flags.QueueQPS,
+		QueueBurst:             flags.QueueBurst,
+		MaxQueueRetries:        flags.MaxQueueRetries,
+		FairQueueBy:            flags.FairQueueBy,
+		Workers:                flags.Workers,
+		ShutdownTimeout:        time.Duration(flags.ShutdownTimeout) * time.Second,
+		ValidPECType:           aws.ValidPECType,
 	}); err != nil {
 		logger.Error(fmt.Sprintf("controller run: %v", err))
 		os.Exit(1)
 	}
 }
 
-func run(logger *slog.Logger, clientset *kubernetes.Clientset, eniClient handler.ENIClient, config k8s.PodControllerConfig) error {
+func run(ctx context.Context, logger *slog.Logger, clientset *kubernetes.Clientset, eniClient handler.ENIClient, kubeCallTimeout time.Duration, config k8s.PodControllerConfig) error {
 	// Create event broadcaster and recorder
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
 	eventRecorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "aws-pod-eip-controller"})
 	defer eventBroadcaster.Shutdown()
 
-	podHandler := handler.NewHandler(logger, clientset.CoreV1(), eniClient, eventRecorder)
+	podHandler := handler.NewHandler(logger, clientset.CoreV1(), eniClient, eventRecorder, kubeCallTimeout)
 	podController, err := k8s.NewPodController(logger, clientset, podHandler, config)
 	if err != nil {
 		return fmt.Errorf("new pod informer: %v", err)
 	}
+	podHandler.OnPoolRelease(podController.WakePending)
 
-	podController.Run(getStopCh(logger))
+	podController.Run(ctx)
 	logger.Info("controller stopped")
 	return nil
 }
 
-func getStopCh(logger *slog.Logger) <-chan struct{} {
-	stopCh := make(chan struct{})
+// getStopContext returns a context which is cancelled on SIGINT or SIGTERM
+func getStopContext(logger *slog.Logger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		logger.Debug("listening for SIGINT and SIGTERM")
 		s := <-sigCh
 		logger.Info(fmt.Sprintf("received %s signal, stopping", s))
-		close(stopCh)
+		cancel()
 	}()
-	return stopCh
+	return ctx
 }
 
 // setVpcIdAndRegion checks if the vpc id and region are set in flags, if not, it will retrieve it from imds service
@@ -0,0 +1,101 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+// describeAssociationsTimeout is the timeout of all calls of DescribeAssociations, it pages through all network interfaces of the VPC
+const describeAssociationsTimeout = 5 * time.Minute
+
+// Associations are the addresses of the cluster and the public IPs associated to the private IPs of the VPC
+type Associations struct {
+	// PodAddresses are the controller addresses of the cluster by the pod key they are tagged with
+	PodAddresses map[string]PodAddress
+	// PublicIPs are the public IPs by the private IP they are associated to
+	PublicIPs map[string]string
+}
+
+type PodAddress struct {
+	AllocationID string
+	PublicIP     string
+	// PrivateIP is empty when the address is not associated
+	PrivateIP string
+	PECType   string
+}
+
+// DescribeAssociations returns the controller addresses of the cluster and the public IPs of all network interfaces
+// of the VPC in batch calls, so the state of all pods can be checked at once
+func (c EC2Client) DescribeAssociations(ctx context.Context) (Associations, error) {
+	ctx, cancel := context.WithTimeout(ctx, describeAssociationsTimeout)
+	defer cancel()
+
+	// aws ec2 describe-addresses --filters Name=tag:aws-samples.github.com/aws-pod-eip-controller-cluster-name,Values=cluster
+	addresses, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String(fmt.Sprintf("tag:%s", pkg.TagClusterNameKey)),
+				Values: []string{c.clusterName},
+			},
+		},
+	})
+	if err != nil {
+		return Associations{}, fmt.Errorf("describe addresses cluster %s: %w", c.clusterName, classify(err))
+	}
+	associations := Associations{
+		PodAddresses: make(map[string]PodAddress),
+		PublicIPs:    make(map[string]string),
+	}
+	for _, v := range addresses.Addresses {
+		addr := toAddress(v)
+		podKey, ok := addr.tags[pkg.TagPodKey]
+		if !ok {
+			continue
+		}
+		podAddress := PodAddress{
+			AllocationID: addr.allocationID,
+			PublicIP:     addr.publicIP,
+			PECType:      addr.tags[pkg.TagTypeKey],
+		}
+		if addr.associationID != "" {
+			podAddress.PrivateIP = addr.privateIP
+		}
+		associations.PodAddresses[podKey] = podAddress
+	}
+
+	// aws ec2 describe-network-interfaces --filters Name=vpc-id,Values=vpc-0d46053e21e3a2cf9
+	paginator := ec2.NewDescribeNetworkInterfacesPaginator(c.client, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []string{c.vpcID},
+			},
+		},
+		MaxResults: aws.Int32(1000),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return Associations{}, fmt.Errorf("describe-network-interfaces vpc-id %s: %w", c.vpcID, classify(err))
+		}
+		for _, ni := range page.NetworkInterfaces {
+			for _, ip := range ni.PrivateIpAddresses {
+				if ip.Association != nil && ip.Association.PublicIp != nil {
+					associations.PublicIPs[aws.ToString(ip.PrivateIpAddress)] = aws.ToString(ip.Association.PublicIp)
+				}
+			}
+		}
+	}
+	c.logger.Debug(fmt.Sprintf("described %d pod addresses and %d associated private IPs", len(associations.PodAddresses), len(associations.PublicIPs)))
+	return associations, nil
+}
@@ -0,0 +1,275 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+const (
+	// defaultPublicIPv4Pool is the Amazon pool of auto mode addresses
+	defaultPublicIPv4Pool = "amazon"
+	// ipamPoolPrefix is the ID prefix of IPAM pools and coipPoolPrefix of customer-owned IPv4 pools, other pools are
+	// public IPv4 pools
+	ipamPoolPrefix = "ipam-pool-"
+	coipPoolPrefix = "ipv4pool-coip-"
+)
+
+var (
+	// ipamPoolIDPattern is the format of the IPAM pool ID annotation
+	ipamPoolIDPattern = regexp.MustCompile(`^ipam-pool-[0-9a-f]+$`)
+	// coipPoolIDPattern is the format of the CoIP pool ID annotation
+	coipPoolIDPattern = regexp.MustCompile(`^ipv4pool-coip-[0-9a-f]+$`)
+)
+
+func init() {
+	RegisterAddressProvider(autoProvider{})
+}
+
+// autoProvider allocates an address from the first pool of the pod with capacity left and releases it on deletion
+type autoProvider struct{}
+
+func (autoProvider) Type() string {
+	return pkg.PodEIPAnnotationValueAuto
+}
+
+func (autoProvider) DesiredState() []StateKey {
+	return []StateKey{
+		{Annotation: pkg.PodAddressPoolAnnotationKey, Label: pkg.PodAddressPoolIDLabel},
+		{Annotation: pkg.PodAddressIPAMPoolAnnotationKey, Label: pkg.PodIPAMPoolLabel},
+		{Annotation: pkg.PodAddressIPAMAddressAnnotationKey, Label: pkg.PodIPAMAddressLabel},
+		{Annotation: pkg.PodAddressCoIPPoolAnnotationKey, Label: pkg.PodCoIPPoolLabel},
+		{Annotation: pkg.PodAddressStickyKeyAnnotationKey, Label: pkg.PodStickyKeyLabel},
+	}
+}
+
+// LockKey is the sticky identity of the pod, so an address parked for it is not taken by multiple pods
+func (autoProvider) LockKey(options AssociateAddressOptions) string {
+	if identity := stickyIdentity(options); identity != "" {
+		return stickyLockKey(identity)
+	}
+	return ""
+}
+
+// Acquire reuses the address parked for the sticky identity of the pod, otherwise it allocates an address which is
+// tagged with the identity, so it is parked on pod deletion
+func (p autoProvider) Acquire(ctx context.Context, c EC2Client, options AssociateAddressOptions) (AcquiredAddress, error) {
+	identity := stickyIdentity(options)
+	if c.stickyRetainPeriod <= 0 || identity == "" {
+		return p.allocate(ctx, c, options, "")
+	}
+	if acquired, ok, err := c.takeParkedAddress(ctx, options.PodKey, identity); ok || err != nil {
+		return acquired, err
+	}
+	return p.allocate(ctx, c, options, identity)
+}
+
+// allocate falls back to the next pool when a pool has no address left, the pool used is recorded in a pod label. The
+// IPAM pool comes first, it falls back to the public IPv4 pools only if the pool annotation is set. Pods in Wavelength
+// Zones get a carrier IP of the carrier network instead, pods with a CoIP pool a customer-owned IP of the pool. The
+// address is tagged with the sticky identity unless it is empty.
+func (autoProvider) allocate(ctx context.Context, c EC2Client, options AssociateAddressOptions, identity string) (AcquiredAddress, error) {
+	if coipPool := options.Annotations[pkg.PodAddressCoIPPoolAnnotationKey]; coipPool != "" {
+		return c.acquireCoIPAddress(ctx, options, coipPool, identity)
+	}
+	if options.Carrier {
+		allocationID, carrierIP, err := c.allocateAddress(ctx, options.PodKey, identity, "", "", options.NetworkBorderGroup)
+		if err != nil {
+			return AcquiredAddress{}, err
+		}
+		return AcquiredAddress{
+			AllocationID: allocationID,
+			PublicIP:     carrierIP,
+			Labels:       map[string]string{pkg.PodNetworkBorderGroupLabel: options.NetworkBorderGroup},
+		}, nil
+	}
+	ipamPool, ipamAddress, err := ipamAllocation(options.Annotations)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	pools := addressPools(options.Annotations[pkg.PodAddressPoolAnnotationKey])
+	if ipamPool != "" {
+		if _, ok := options.Annotations[pkg.PodAddressPoolAnnotationKey]; ok {
+			pools = append([]string{ipamPool}, pools...)
+		} else {
+			pools = []string{ipamPool}
+		}
+	}
+	for i, pool := range pools {
+		var allocationID, publicIP, addr string
+		if pool == ipamPool {
+			addr = ipamAddress
+		}
+		allocationID, publicIP, err = c.allocateAddress(ctx, options.PodKey, identity, pool, addr, options.NetworkBorderGroup)
+		if err == nil {
+			return AcquiredAddress{
+				AllocationID: allocationID,
+				PublicIP:     publicIP,
+				Labels: map[string]string{
+					pkg.PodAllocatedPoolLabel:      pool,
+					pkg.PodNetworkBorderGroupLabel: options.NetworkBorderGroup,
+				},
+			}, nil
+		}
+		if !errors.Is(err, ErrInsufficientCapacity) {
+			return AcquiredAddress{}, err
+		}
+		if i < len(pools)-1 {
+			c.logger.Warn(fmt.Sprintf("pool %s has no capacity for %s pod, falling back to pool %s: %v", pool, options.PodKey, pools[i+1], err))
+		}
+	}
+	return AcquiredAddress{}, err
+}
+
+// Release parks the address of a sticky identity, otherwise it returns the address to the warm pool or releases it,
+// warm pools are public IPv4 pools of the region network border group
+func (autoProvider) Release(ctx context.Context, c EC2Client, addr address) ([]string, error) {
+	if identity := addr.tags[pkg.TagStickyKey]; identity != "" && c.stickyRetainPeriod > 0 {
+		return nil, c.parkAddress(ctx, addr, identity)
+	}
+	if addr.customerOwnedIPv4Pool != "" || (addr.networkBorderGroup != "" && addr.networkBorderGroup != c.region) {
+		return nil, c.releaseAddress(ctx, addr.allocationID)
+	}
+	if ok, err := c.returnWarmAddress(ctx, addr.allocationID, addr.publicIPv4Pool); ok || err != nil {
+		return nil, err
+	}
+	return nil, c.releaseAddress(ctx, addr.allocationID)
+}
+
+// acquireCoIPAddress allocates a customer-owned IP of the CoIP pool, it does not fall back to public IPv4 pools as
+// customer-owned IPs are routed in the on-premises network
+func (c EC2Client) acquireCoIPAddress(ctx context.Context, options AssociateAddressOptions, pool, identity string) (AcquiredAddress, error) {
+	if !coipPoolIDPattern.MatchString(pool) {
+		return AcquiredAddress{}, newError(ErrInvalidParameter, "coip pool %q is not a customer-owned IPv4 pool ID", pool)
+	}
+	if options.Annotations[pkg.PodAddressIPAMPoolAnnotationKey] != "" {
+		return AcquiredAddress{}, newError(ErrInvalidParameter, "coip pool %s and ipam pool can not both be set", pool)
+	}
+	allocationID, customerOwnedIP, err := c.allocateAddress(ctx, options.PodKey, identity, pool, "", "")
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	return AcquiredAddress{
+		AllocationID: allocationID,
+		PublicIP:     customerOwnedIP,
+		Labels: map[string]string{
+			pkg.PodAllocatedPoolLabel:   pool,
+			pkg.PodCustomerOwnedIPLabel: customerOwnedIP,
+		},
+	}, nil
+}
+
+// addressPools returns the pools of the pool annotation in order, the Amazon pool without one
+func addressPools(annotation string) []string {
+	var pools []string
+	for _, pool := range strings.Split(annotation, ",") {
+		if pool = strings.TrimSpace(pool); pool != "" {
+			pools = append(pools, pool)
+		}
+	}
+	if len(pools) == 0 {
+		return []string{defaultPublicIPv4Pool}
+	}
+	return pools
+}
+
+// ipamAllocation returns the validated IPAM pool and address of the pod annotations, the address without a netmask
+func ipamAllocation(annotations map[string]string) (pool string, addr string, err error) {
+	pool = annotations[pkg.PodAddressIPAMPoolAnnotationKey]
+	addr = annotations[pkg.PodAddressIPAMAddressAnnotationKey]
+	if pool != "" && !ipamPoolIDPattern.MatchString(pool) {
+		return "", "", newError(ErrInvalidParameter, "ipam pool %q is not an IPAM pool ID", pool)
+	}
+	if addr == "" {
+		return pool, "", nil
+	}
+	if pool == "" {
+		return "", "", newError(ErrInvalidParameter, "ipam address %s requires an ipam pool", addr)
+	}
+	if !strings.Contains(addr, "/") {
+		addr += "/32"
+	}
+	prefix, err := netip.ParsePrefix(addr)
+	if err != nil || !prefix.Addr().Is4() || prefix.Bits() != 32 {
+		return "", "", newError(ErrInvalidParameter, "ipam address %q is not an IPv4 address or /32 prefix", annotations[pkg.PodAddressIPAMAddressAnnotationKey])
+	}
+	return pool, prefix.Addr().String(), nil
+}
+
+// setAddressPool sets the IPAM pool, customer-owned IPv4 pool or public IPv4 pool of the allocation
+func setAddressPool(input *ec2.AllocateAddressInput, pool string) {
+	switch {
+	case strings.HasPrefix(pool, ipamPoolPrefix):
+		input.IpamPoolId = aws.String(pool)
+	case strings.HasPrefix(pool, coipPoolPrefix):
+		// aws ec2 allocate-address --customer-owned-ipv4-pool ipv4pool-coip-0123456789abcdef0
+		input.CustomerOwnedIpv4Pool = aws.String(pool)
+	default:
+		input.PublicIpv4Pool = aws.String(pool)
+	}
+}
+
+// allocateAddress allocates an address of the pool, the specific address if set, otherwise an address of the warm pool
+// is taken first. Addresses of a network border group are not taken from warm pools, without a pool it is a carrier IP.
+// The address is tagged with the sticky identity unless it is empty.
+func (c EC2Client) allocateAddress(ctx context.Context, podKey, identity, addressPoolId, addr, networkBorderGroup string) (allocationID string, publicIP string, err error) {
+	if addr == "" && networkBorderGroup == "" {
+		if allocationID, publicIP, ok, err := c.takeWarmAddress(ctx, podKey, identity, addressPoolId); ok || err != nil {
+			return allocationID, publicIP, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 allocate-address --public-ipv4-pool amazon
+	input := &ec2.AllocateAddressInput{
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeElasticIp,
+				Tags: []types.Tag{
+					{Key: aws.String(pkg.TagTypeKey), Value: aws.String(pkg.PodEIPAnnotationValueAuto)},
+					{Key: aws.String(pkg.TagClusterNameKey), Value: aws.String(c.clusterName)},
+					{Key: aws.String(pkg.TagPodKey), Value: aws.String(podKey)},
+				},
+			},
+		},
+	}
+	if identity != "" {
+		// tagged on allocation, so the address is not left behind without the tag
+		input.TagSpecifications[0].Tags = append(input.TagSpecifications[0].Tags, types.Tag{Key: aws.String(pkg.TagStickyKey), Value: aws.String(identity)})
+	}
+	if addressPoolId != "" {
+		setAddressPool(input, addressPoolId)
+	}
+	if addr != "" {
+		input.Address = aws.String(addr)
+	}
+	if networkBorderGroup != "" {
+		// aws ec2 allocate-address --network-border-group us-east-1-wl1-bos-wlz-1
+		input.NetworkBorderGroup = aws.String(networkBorderGroup)
+	}
+	allocatedResult, err := c.client.AllocateAddress(ctx, input)
+	if err != nil {
+		return "", "", fmt.Errorf("allocate address pool %q network border group %q: %w", addressPoolId, networkBorderGroup, classify(err))
+	}
+	if allocatedResult.CarrierIp != nil {
+		return aws.ToString(allocatedResult.AllocationId), aws.ToString(allocatedResult.CarrierIp), nil
+	}
+	if allocatedResult.CustomerOwnedIp != nil {
+		return aws.ToString(allocatedResult.AllocationId), aws.ToString(allocatedResult.CustomerOwnedIp), nil
+	}
+	return aws.ToString(allocatedResult.AllocationId), aws.ToString(allocatedResult.PublicIp), nil
+}
@@ -0,0 +1,239 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestAddressPools(t *testing.T) {
+	for annotation, want := range map[string][]string{
+		"":                                     {"amazon"},
+		" , ":                                  {"amazon"},
+		"ipv4pool-ec2-1":                       {"ipv4pool-ec2-1"},
+		"ipv4pool-ec2-1,amazon":                {"ipv4pool-ec2-1", "amazon"},
+		" ipv4pool-ec2-1 , ipv4pool-ec2-2 ,, ": {"ipv4pool-ec2-1", "ipv4pool-ec2-2"},
+		"amazon,ipv4pool-ec2-1,ipv4pool-ec2-2": {"amazon", "ipv4pool-ec2-1", "ipv4pool-ec2-2"},
+	} {
+		t.Run(fmt.Sprintf("given pool annotation %q when pools are listed then they are in order", annotation), func(t *testing.T) {
+			assert.Equal(t, want, addressPools(annotation))
+		})
+	}
+}
+
+func TestAutoProvider_Acquire(t *testing.T) {
+	t.Run("given pools when the first pool has no capacity then the address is allocated from the next pool", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testEC2Error("InsufficientAddressCapacity", "no capacity"), testAllocateAddress("eipalloc-1", "1.1.1.1")},
+		})
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{pkg.PodAddressPoolAnnotationKey: "ipv4pool-ec2-1,amazon"}))
+		assert.NoError(t, err)
+		assert.Equal(t, "eipalloc-1", acquired.AllocationID)
+		assert.Equal(t, "1.1.1.1", acquired.PublicIP)
+		assert.Equal(t, "amazon", acquired.Labels[pkg.PodAllocatedPoolLabel])
+		requests := endpoint.requested("AllocateAddress")
+		assert.Len(t, requests, 2)
+		assert.Equal(t, "ipv4pool-ec2-1", requests[0].Get("PublicIpv4Pool"))
+		assert.Equal(t, "amazon", requests[1].Get("PublicIpv4Pool"))
+	})
+
+	t.Run("given pools when no pool has capacity then insufficient capacity is returned", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testEC2Error("InsufficientAddressCapacity", "no capacity")},
+		})
+
+		_, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{pkg.PodAddressPoolAnnotationKey: "ipv4pool-ec2-1,ipv4pool-ec2-2"}))
+		assert.ErrorIs(t, err, ErrInsufficientCapacity)
+		assert.Len(t, endpoint.requested("AllocateAddress"), 2)
+	})
+
+	t.Run("given pools when the first pool fails with another error then the next pool is not tried", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testEC2Error("InvalidPublicIpv4PoolID.NotFound", "not found")},
+		})
+
+		_, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{pkg.PodAddressPoolAnnotationKey: "ipv4pool-ec2-1,amazon"}))
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Len(t, endpoint.requested("AllocateAddress"), 1)
+	})
+}
+
+func TestIPAMAllocation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		annotations map[string]string
+		pool        string
+		addr        string
+	}{
+		"given no IPAM annotations when the allocation is validated then it is empty": {
+			annotations: nil,
+		},
+		"given IPAM pool when the allocation is validated then any address of the pool is allocated": {
+			annotations: map[string]string{pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd"},
+			pool:        "ipam-pool-0123abcd",
+		},
+		"given IPAM pool and address when the allocation is validated then the address is allocated": {
+			annotations: map[string]string{pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd", pkg.PodAddressIPAMAddressAnnotationKey: "203.0.113.10"},
+			pool:        "ipam-pool-0123abcd",
+			addr:        "203.0.113.10",
+		},
+		"given IPAM pool and /32 prefix when the allocation is validated then the address is allocated without netmask": {
+			annotations: map[string]string{pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd", pkg.PodAddressIPAMAddressAnnotationKey: "203.0.113.10/32"},
+			pool:        "ipam-pool-0123abcd",
+			addr:        "203.0.113.10",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pool, addr, err := ipamAllocation(tc.annotations)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.pool, pool)
+			assert.Equal(t, tc.addr, addr)
+		})
+	}
+
+	for name, annotations := range map[string]map[string]string{
+		"given pool which is not an IPAM pool ID when the allocation is validated then it is invalid": {
+			pkg.PodAddressIPAMPoolAnnotationKey: "ipv4pool-ec2-1",
+		},
+		"given address without pool when the allocation is validated then it is invalid": {
+			pkg.PodAddressIPAMAddressAnnotationKey: "203.0.113.10",
+		},
+		"given IPv6 address when the allocation is validated then it is invalid": {
+			pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd", pkg.PodAddressIPAMAddressAnnotationKey: "2001:db8::1",
+		},
+		"given prefix larger than an address when the allocation is validated then it is invalid": {
+			pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd", pkg.PodAddressIPAMAddressAnnotationKey: "203.0.113.0/24",
+		},
+		"given malformed address when the allocation is validated then it is invalid": {
+			pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd", pkg.PodAddressIPAMAddressAnnotationKey: "203.0.113",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := ipamAllocation(annotations)
+			assert.ErrorIs(t, err, ErrInvalidParameter)
+		})
+	}
+}
+
+func TestAutoProvider_Acquire_ipam(t *testing.T) {
+	t.Run("given IPAM pool and address when address is acquired then it is allocated from the IPAM pool", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testAllocateAddress("eipalloc-1", "203.0.113.10")},
+		})
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{
+			pkg.PodAddressIPAMPoolAnnotationKey:    "ipam-pool-0123abcd",
+			pkg.PodAddressIPAMAddressAnnotationKey: "203.0.113.10",
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, "ipam-pool-0123abcd", acquired.Labels[pkg.PodAllocatedPoolLabel])
+		requests := endpoint.requested("AllocateAddress")
+		assert.Len(t, requests, 1)
+		assert.Equal(t, "ipam-pool-0123abcd", requests[0].Get("IpamPoolId"))
+		assert.Equal(t, "203.0.113.10", requests[0].Get("Address"))
+		assert.Empty(t, requests[0].Get("PublicIpv4Pool"))
+	})
+
+	t.Run("given IPAM pool without pool annotation when the IPAM pool has no capacity then it does not fall back", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testEC2Error("InsufficientAddressCapacity", "no capacity")},
+		})
+
+		_, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd"}))
+		assert.ErrorIs(t, err, ErrInsufficientCapacity)
+		assert.Len(t, endpoint.requested("AllocateAddress"), 1)
+	})
+
+	t.Run("given IPAM pool and pool annotation when the IPAM pool has no capacity then it falls back to the pools", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testEC2Error("InsufficientAddressCapacity", "no capacity"), testAllocateAddress("eipalloc-1", "1.1.1.1")},
+		})
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{
+			pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd",
+			pkg.PodAddressPoolAnnotationKey:     "amazon",
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, "amazon", acquired.Labels[pkg.PodAllocatedPoolLabel])
+		requests := endpoint.requested("AllocateAddress")
+		assert.Len(t, requests, 2)
+		assert.Equal(t, "ipam-pool-0123abcd", requests[0].Get("IpamPoolId"))
+		assert.Equal(t, "amazon", requests[1].Get("PublicIpv4Pool"))
+	})
+}
+
+func TestSetAddressPool(t *testing.T) {
+	for pool, want := range map[string]ec2.AllocateAddressInput{
+		"amazon":                          {PublicIpv4Pool: aws.String("amazon")},
+		"ipv4pool-ec2-1":                  {PublicIpv4Pool: aws.String("ipv4pool-ec2-1")},
+		"ipam-pool-0123abcd":              {IpamPoolId: aws.String("ipam-pool-0123abcd")},
+		"ipv4pool-coip-0123456789abcdef0": {CustomerOwnedIpv4Pool: aws.String("ipv4pool-coip-0123456789abcdef0")},
+	} {
+		t.Run(fmt.Sprintf("given pool %q when it is set then it is the pool of its kind", pool), func(t *testing.T) {
+			input := ec2.AllocateAddressInput{}
+			setAddressPool(&input, pool)
+			assert.Equal(t, want, input)
+		})
+	}
+}
+
+func TestAutoProvider_Acquire_coip(t *testing.T) {
+	t.Run("given CoIP pool when address is acquired then a customer-owned IP of the pool is allocated", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testAllocateIP("eipalloc-1", "customerOwnedIp", "192.168.10.1")},
+		})
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{
+			pkg.PodAddressCoIPPoolAnnotationKey: "ipv4pool-coip-0123456789abcdef0",
+			pkg.PodAddressPoolAnnotationKey:     "amazon",
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, "192.168.10.1", acquired.PublicIP)
+		assert.Equal(t, "192.168.10.1", acquired.Labels[pkg.PodCustomerOwnedIPLabel])
+		assert.Equal(t, "ipv4pool-coip-0123456789abcdef0", acquired.Labels[pkg.PodAllocatedPoolLabel])
+		requests := endpoint.requested("AllocateAddress")
+		assert.Len(t, requests, 1)
+		assert.Equal(t, "ipv4pool-coip-0123456789abcdef0", requests[0].Get("CustomerOwnedIpv4Pool"))
+		assert.Empty(t, requests[0].Get("PublicIpv4Pool"))
+	})
+
+	t.Run("given CoIP pool when it has no capacity then it does not fall back to the pools", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testEC2Error("InsufficientAddressCapacity", "no capacity")},
+		})
+
+		_, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(map[string]string{
+			pkg.PodAddressCoIPPoolAnnotationKey: "ipv4pool-coip-0123456789abcdef0",
+			pkg.PodAddressPoolAnnotationKey:     "amazon",
+		}))
+		assert.ErrorIs(t, err, ErrInsufficientCapacity)
+		assert.Len(t, endpoint.requested("AllocateAddress"), 1)
+	})
+
+	for name, annotations := range map[string]map[string]string{
+		"given pool which is not a CoIP pool ID when address is acquired then it is invalid": {
+			pkg.PodAddressCoIPPoolAnnotationKey: "ipv4pool-ec2-1",
+		},
+		"given CoIP pool and IPAM pool when address is acquired then it is invalid": {
+			pkg.PodAddressCoIPPoolAnnotationKey: "ipv4pool-coip-0123456789abcdef0",
+			pkg.PodAddressIPAMPoolAnnotationKey: "ipam-pool-0123abcd",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, endpoint := newTestEC2Client(t, nil)
+
+			_, err := autoProvider{}.Acquire(context.Background(), c, testAutoOptions(annotations))
+			assert.ErrorIs(t, err, ErrInvalidParameter)
+			assert.Empty(t, endpoint.called())
+		})
+	}
+}
@@ -5,12 +5,14 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
@@ -24,137 +26,305 @@ func init() {
 	keyLocks = NewKeyLock()
 }
 
+// verifyInterval is the delay between checks of a new association
+const verifyInterval = time.Second
+
 type EC2Client struct {
-	logger      *slog.Logger
-	vpcID       string
-	client      *ec2.Client
-	clusterName string
+	logger         *slog.Logger
+	region         string
+	vpcID          string
+	client         *ec2.Client
+	clusterName    string
+	verifyTimeout  time.Duration
+	replaceForeign bool
+	warmPool       WarmPoolConfig
+	callTimeout    time.Duration
+	// stickyRetainPeriod is how long the auto mode address of a sticky identity is parked, 0 disables parking
+	stickyRetainPeriod time.Duration
+}
+
+type EC2ClientConfig struct {
+	Region      string
+	VpcID       string
+	ClusterName string
+	// AssociationVerifyTimeout is how long to wait for a new association to be visible, 0 disables the verification
+	AssociationVerifyTimeout time.Duration
+	// ReplaceForeignAddresses allows disassociating addresses not owned by the controller from pod private IPs
+	ReplaceForeignAddresses bool
+	// DescribeRateLimit applies to Describe* actions, MutateRateLimit to all other actions
+	DescribeRateLimit RateLimit
+	MutateRateLimit   RateLimit
+	WarmPool          WarmPoolConfig
+	// CallTimeout is the timeout of every EC2 call
+	CallTimeout time.Duration
+	// StickyRetainPeriod is how long the auto mode address of a pod with a sticky identity is kept for the next pod with
+	// the identity before it is released, 0 releases it immediately
+	StickyRetainPeriod time.Duration
 }
 
-func NewEC2Client(logger *slog.Logger, region, vpcID, clusterName string) (EC2Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func NewEC2Client(logger *slog.Logger, clientConfig EC2ClientConfig) (EC2Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clientConfig.CallTimeout)
 	defer cancel()
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	// adaptive retry mode slows down all calls of the client when they are throttled
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(clientConfig.Region), config.WithRetryer(func() aws.Retryer {
+		return retry.NewAdaptiveMode()
+	}))
 	if err != nil {
 		return EC2Client{}, err
 	}
 
+	logger = logger.With("component", "ec2")
+	limiter := newRateLimiter(logger, clientConfig.DescribeRateLimit, clientConfig.MutateRateLimit)
 	return EC2Client{
-		logger:      logger.With("component", "ec2"),
-		vpcID:       vpcID,
-		client:      ec2.NewFromConfig(cfg),
-		clusterName: clusterName,
+		logger: logger,
+		region: clientConfig.Region,
+		vpcID:  clientConfig.VpcID,
+		client: ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+			o.APIOptions = append(o.APIOptions, limiter.addMiddleware)
+		}),
+		clusterName:        clientConfig.ClusterName,
+		verifyTimeout:      clientConfig.AssociationVerifyTimeout,
+		replaceForeign:     clientConfig.ReplaceForeignAddresses,
+		warmPool:           clientConfig.WarmPool,
+		callTimeout:        clientConfig.CallTimeout,
+		stickyRetainPeriod: clientConfig.StickyRetainPeriod,
 	}, nil
 }
 
+type AssociateAddressResult struct {
+	PublicIP string
+	// Labels are the labels of the acquired address to add to the pod, see AcquiredAddress
+	Labels map[string]string
+	// Displaced are the addresses which were associated to the pod private IP before
+	Displaced []DisplacedAddress
+	// Pools are the fixed-tag pools displaced addresses were returned to
+	Pools []string
+}
+
+type DisplacedAddress struct {
+	PublicIP     string
+	AllocationID string
+	// Owner is the key of the pod the address was tagged with, empty if it is not owned by the controller in this cluster
+	Owner string
+}
+
 type AssociateAddressOptions struct {
-	PodKey        string
-	PodIP         string
-	HostIP        string
-	AddressPoolId string
-	PECType       string
-	TagKey        string
-	TagValueKey   string
+	PodKey  string
+	PodIP   string
+	HostIP  string
+	PECType string
+	// Annotations of the pod, the address provider of the PEC type reads its parameters from them
+	Annotations map[string]string
+	Labels      map[string]string
+	// OwnerKind and OwnerName are the controller owner reference of the pod, empty without one
+	OwnerKind string
+	OwnerName string
+	// NetworkBorderGroup is the network border group of the Local Zone or Wavelength Zone of the pod network interface,
+	// Carrier is true for Wavelength Zones. They are set by AssociateAddress in auto mode.
+	NetworkBorderGroup string
+	Carrier            bool
 }
 
-func (c EC2Client) AssociateAddress(options AssociateAddressOptions) (string, error) {
-	ni, err := c.getNetworkInterface(options.PodIP, options.HostIP)
+// AssociateAddress associates an address of the mode to the pod, on error the result still has the displaced addresses
+func (c EC2Client) AssociateAddress(ctx context.Context, options AssociateAddressOptions) (AssociateAddressResult, error) {
+	provider, ok := GetAddressProvider(options.PECType)
+	if !ok {
+		return AssociateAddressResult{}, newError(ErrInvalidParameter, "unsupported PEC type %s", options.PECType)
+	}
+	ni, err := c.getNetworkInterface(ctx, options.PodIP, options.HostIP)
 	if err != nil {
-		return "", err
+		return AssociateAddressResult{}, err
 	}
-	var allocationID, publicIP string
-	switch options.PECType {
-	case pkg.PodEIPAnnotationValueAuto:
-		allocationID, publicIP, err = c.allocateAddress(options.PodKey, options.AddressPoolId)
+	if options.PECType == pkg.PodEIPAnnotationValueAuto {
+		// only auto mode allocates addresses in the network border group of the zone
+		z, err := c.describeZone(ctx, ni.availabilityZone)
 		if err != nil {
-			return "", err
+			return AssociateAddressResult{}, err
 		}
-	case pkg.PodEIPAnnotationValueFixedTag:
-		keyLocks.Lock(options.TagKey)
-		defer keyLocks.Unlock(options.TagKey)
-		allocationID, publicIP, err = c.getTagAddress(options.TagKey)
-		if err != nil {
-			return "", err
+		options.NetworkBorderGroup, options.Carrier = z.borderGroup(), z.carrier()
+	}
+	result, err := c.displaceAddresses(ctx, options.PodKey, options.PodIP, ni.id)
+	if err != nil {
+		return result, err
+	}
+	acquired, err := c.acquireAddress(ctx, provider, options, ni.id)
+	if err != nil {
+		if acquired.AllocationID != "" {
+			// the address was acquired but not associated, it is returned like an unverified association
+			if rollbackErr := c.rollbackAssociation(ctx, acquired.AllocationID); rollbackErr != nil {
+				return result, fmt.Errorf("%w, %w", err, rollbackErr)
+			}
 		}
-		if err := c.createTag(allocationID, map[string]string{
-			pkg.TagPodKey:         options.PodKey,
-			pkg.TagClusterNameKey: c.clusterName,
-			pkg.TagTypeKey:        pkg.PodEIPAnnotationValueFixedTag,
-		}); err != nil {
-			return "", err
+		return result, err
+	}
+	allocationID := acquired.AllocationID
+	// the rollback returns the address with the provider, which may take the lock of the provider
+	if err := c.verifyAssociation(ctx, allocationID, ni.id, options.PodIP); err != nil {
+		if rollbackErr := c.rollbackAssociation(ctx, allocationID); rollbackErr != nil {
+			return result, fmt.Errorf("%w, %w", err, rollbackErr)
 		}
-	case pkg.PodEIPAnnotationValueFixedTagValue:
-		allocationID, publicIP, err = c.getTagValueAddress(options.TagValueKey, options.PodKey)
-		if err != nil {
-			return "", err
+		return result, err
+	}
+	result.PublicIP = acquired.PublicIP
+	result.Labels = acquired.Labels
+	return result, nil
+}
+
+// acquireAddress acquires an address with the provider and associates it to the network interface, holding the lock
+// of the provider. If the association fails, the acquired address is returned with the error to be rolled back.
+func (c EC2Client) acquireAddress(ctx context.Context, provider AddressProvider, options AssociateAddressOptions, eniID string) (AcquiredAddress, error) {
+	if key := provider.LockKey(options); key != "" {
+		keyLocks.Lock(key)
+		defer keyLocks.Unlock(key)
+	}
+	acquired, err := provider.Acquire(ctx, c, options)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	if err := c.associateAddress(ctx, acquired.AllocationID, eniID, options.PodIP); err != nil {
+		return acquired, err
+	}
+	return acquired, nil
+}
+
+// displaceAddresses disassociates addresses already associated to the private IP, e.g. left behind by a previous pod with the same IP.
+// Addresses owned by the controller in this cluster are returned like on pod deletion, other addresses are replaced only if enabled.
+// On error the result has the addresses displaced so far.
+func (c EC2Client) displaceAddresses(ctx context.Context, podKey, privateIP, eniID string) (AssociateAddressResult, error) {
+	addrs, err := c.describeAddresses(ctx, privateIP, eniID)
+	if err != nil {
+		return AssociateAddressResult{}, err
+	}
+	var result AssociateAddressResult
+	for _, addr := range addrs {
+		if addr.associationID == "" {
+			continue
+		}
+		owner, owned := addr.tags[pkg.TagPodKey]
+		if !owned || addr.tags[pkg.TagClusterNameKey] != c.clusterName {
+			if !c.replaceForeign {
+				return result, newError(ErrConflict, "private-ip-address %s of pod %s already has address %s (allocation-id %s) associated which is not owned by the controller",
+					privateIP, podKey, addr.publicIP, addr.allocationID)
+			}
+			owner = ""
 		}
-		if err := c.createTag(allocationID, map[string]string{
-			pkg.TagPodKey:         options.PodKey,
-			pkg.TagClusterNameKey: c.clusterName,
-			pkg.TagTypeKey:        pkg.PodEIPAnnotationValueFixedTagValue,
-		}); err != nil {
-			return "", err
+		c.logger.Info(fmt.Sprintf("displacing address %s (allocation-id %s) of %q owner from private-ip-address %s for pod %s", addr.publicIP, addr.allocationID, owner, privateIP, podKey))
+		if err := c.disassociateAddress(ctx, addr.associationID); err != nil && !errors.Is(err, ErrNotFound) {
+			return result, err
+		}
+		// the address is displaced once it is disassociated, even if it can not be returned
+		result.Displaced = append(result.Displaced, DisplacedAddress{
+			PublicIP:     addr.publicIP,
+			AllocationID: addr.allocationID,
+			Owner:        owner,
+		})
+		if owner != "" {
+			pools, err := c.returnAddress(ctx, addr)
+			if err != nil {
+				return result, err
+			}
+			result.Pools = append(result.Pools, pools...)
 		}
-	default:
-		return "", fmt.Errorf("unsupported PEC type %s", options.PECType)
 	}
-	if err := c.associateAddress(allocationID, ni.id, options.PodIP); err != nil {
-		return "", err
+	return result, nil
+}
+
+// verifyAssociation waits until the address is visible as associated to the network interface and private IP
+func (c EC2Client) verifyAssociation(ctx context.Context, allocationID, eniID, privateIP string) error {
+	if c.verifyTimeout <= 0 {
+		return nil
 	}
-	return publicIP, nil
+	deadline := time.Now().Add(c.verifyTimeout)
+	for {
+		addr, err := c.describeAllocation(ctx, allocationID)
+		if err == nil && addr.associationID != "" && addr.networkInterfaceID == eniID && addr.privateIP == privateIP {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("verify association allocation-id %s: %w", allocationID, err)
+			}
+			return newError(ErrConflict, "association allocation-id %s network-interface-id %s private-ip-address %s not verified within %s, found network-interface-id %q private-ip-address %q",
+				allocationID, eniID, privateIP, c.verifyTimeout, addr.networkInterfaceID, addr.privateIP)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("verify association allocation-id %s: %w", allocationID, ctx.Err())
+		case <-time.After(verifyInterval):
+		}
+	}
+}
+
+// rollbackAssociation disassociates and returns the address whose association failed or could not be verified, so it
+// can be acquired again on retry. It is not cancelled with the context, so the address is not left behind on shutdown.
+func (c EC2Client) rollbackAssociation(ctx context.Context, allocationID string) error {
+	ctx = context.WithoutCancel(ctx)
+	addr, err := c.describeAllocation(ctx, allocationID)
+	if err != nil {
+		return fmt.Errorf("rollback association allocation-id %s: %w", allocationID, err)
+	}
+	if addr.associationID != "" {
+		if err := c.disassociateAddress(ctx, addr.associationID); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("rollback association allocation-id %s: %w", allocationID, err)
+		}
+	}
+	if _, err := c.returnAddress(ctx, addr); err != nil {
+		return fmt.Errorf("rollback association allocation-id %s: %w", allocationID, err)
+	}
+	c.logger.Info(fmt.Sprintf("rolled back association allocation-id %s", allocationID))
+	return nil
 }
 
 type DisassociateAddressOptions struct {
 	PodKey string
 }
 
-func (c EC2Client) DisassociateAddress(options DisassociateAddressOptions) error {
-	addrs, err := c.describePodAddresses(options.PodKey)
+type DisassociateAddressResult struct {
+	// Pools are the fixed-tag pools the address was returned to, empty if no address went back to a pool
+	Pools []string
+}
+
+func (c EC2Client) DisassociateAddress(ctx context.Context, options DisassociateAddressOptions) (DisassociateAddressResult, error) {
+	addrs, err := c.describePodAddresses(ctx, options.PodKey)
 	if err != nil {
-		return err
+		return DisassociateAddressResult{}, err
 	}
 	if len(addrs) == 0 {
 		c.logger.Info(fmt.Sprintf("no address found for %s pod", options.PodKey))
-		return nil
+		return DisassociateAddressResult{}, nil
 	}
-	if err := c.disassociateAddress(addrs[0].associationID); err != nil {
-		c.logger.Error(fmt.Sprint())
-		return err
-	}
-	tagType, ok := addrs[0].tags[pkg.TagTypeKey]
-	if !ok {
-		return nil
-	}
-	switch tagType {
-	case pkg.PodEIPAnnotationValueAuto: // auto mode release address
-		return c.releaseAddress(addrs[0].allocationID)
-	case pkg.PodEIPAnnotationValueFixedTag: // fixed-tag mode delete eip tag
-		if err := c.deleteTag(addrs[0].allocationID, []string{pkg.TagPodKey, pkg.TagTypeKey, pkg.TagClusterNameKey}); err != nil {
-			return err
-		}
-	case pkg.PodEIPAnnotationValueFixedTagValue: // fixed-tag-value mode delete eip tag
-		if err := c.deleteTag(addrs[0].allocationID, []string{pkg.TagPodKey, pkg.TagTypeKey, pkg.TagClusterNameKey}); err != nil {
-			return err
+	if err := c.disassociateAddress(ctx, addrs[0].associationID); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			c.logger.Error(fmt.Sprintf("disassociate %s pod address %s: %v", options.PodKey, addrs[0].publicIP, err))
+			return DisassociateAddressResult{}, err
 		}
+		// the association is already gone, the address still has to be released or untagged
+		c.logger.Info(fmt.Sprintf("%s pod address %s is already disassociated", options.PodKey, addrs[0].publicIP))
 	}
-	return nil
+	pools, err := c.returnAddress(ctx, addrs[0])
+	if err != nil {
+		return DisassociateAddressResult{}, err
+	}
+	return DisassociateAddressResult{Pools: pools}, nil
 }
 
 type networkInterface struct {
-	id     string
-	status string
+	id               string
+	status           string
+	availabilityZone string
 }
 
 func toNetworkInterface(ni types.NetworkInterface) networkInterface {
 	return networkInterface{
-		id:     aws.ToString(ni.NetworkInterfaceId),
-		status: string(ni.Status),
+		id:               aws.ToString(ni.NetworkInterfaceId),
+		status:           string(ni.Status),
+		availabilityZone: aws.ToString(ni.AvailabilityZone),
 	}
 }
 
-func (c EC2Client) getNetworkInterface(privateIP string, hostIP string) (networkInterface, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) getNetworkInterface(ctx context.Context, privateIP string, hostIP string) (networkInterface, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 
 	// aws ec2 describe-network-interfaces --filters Name=addresses.private-ip-address,Values=10.2.21.154 Name=vpc-id,Values=vpc-0d46053e21e3a2cf9
@@ -171,7 +341,7 @@ func (c EC2Client) getNetworkInterface(privateIP string, hostIP string) (network
 		},
 	})
 	if err != nil {
-		return networkInterface{}, fmt.Errorf("describe-network-interfaces private-ip-address %s vpc-id %s error: %w", privateIP, c.vpcID, err)
+		return networkInterface{}, fmt.Errorf("describe-network-interfaces private-ip-address %s vpc-id %s error: %w", privateIP, c.vpcID, classify(err))
 	}
 	if len(result.NetworkInterfaces) > 0 {
 		return toNetworkInterface(result.NetworkInterfaces[0]), nil
@@ -192,7 +362,7 @@ func (c EC2Client) getNetworkInterface(privateIP string, hostIP string) (network
 		},
 	})
 	if err != nil {
-		return networkInterface{}, fmt.Errorf("describe-network-interfaces host-ip %s vpc-id %s error: %w", hostIP, c.vpcID, err)
+		return networkInterface{}, fmt.Errorf("describe-network-interfaces host-ip %s vpc-id %s error: %w", hostIP, c.vpcID, classify(err))
 	}
 	if len(result.NetworkInterfaces) == 0 {
 		return networkInterface{}, fmt.Errorf("no network interface found for %s private IP host IP %s in %s vpc on ipv4prefixes", privateIP, hostIP, c.vpcID)
@@ -218,7 +388,7 @@ func (c EC2Client) getNetworkInterface(privateIP string, hostIP string) (network
 		},
 	})
 	if err != nil {
-		return networkInterface{}, fmt.Errorf("describe-network-interfaces instance-id %s vpc-id %s error: %w", instanceId, c.vpcID, err)
+		return networkInterface{}, fmt.Errorf("describe-network-interfaces instance-id %s vpc-id %s error: %w", instanceId, c.vpcID, classify(err))
 	}
 	if len(result.NetworkInterfaces) == 0 {
 		return networkInterface{}, fmt.Errorf("no network interface found for instance id %s in %s vpc on ipv4prefixes", instanceId, c.vpcID)
@@ -236,8 +406,8 @@ func (c EC2Client) getNetworkInterface(privateIP string, hostIP string) (network
 	return networkInterface{}, fmt.Errorf("no id found for %s private IP host IP %s in %s vpc on ipv4prefixes", privateIP, hostIP, c.vpcID)
 }
 
-func (c EC2Client) createTag(resource string, kv map[string]string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) createTag(ctx context.Context, resource string, kv map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 	tags := make([]types.Tag, 0, len(kv))
 	for k, v := range kv {
@@ -247,13 +417,13 @@ func (c EC2Client) createTag(resource string, kv map[string]string) error {
 		Resources: []string{resource},
 		Tags:      tags,
 	}); err != nil {
-		return fmt.Errorf("create-tags resource %s tags %v", resource, kv)
+		return fmt.Errorf("create-tags resource %s tags %v: %w", resource, kv, classify(err))
 	}
 	return nil
 }
 
-func (c EC2Client) deleteTag(resource string, keys []string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) deleteTag(ctx context.Context, resource string, keys []string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 	tags := make([]types.Tag, 0, len(keys))
 	for _, key := range keys {
@@ -263,17 +433,22 @@ func (c EC2Client) deleteTag(resource string, keys []string) error {
 		Resources: []string{resource},
 		Tags:      tags,
 	}); err != nil {
-		return fmt.Errorf("delete-tags resource %s tag Keys=%v", resource, keys)
+		return fmt.Errorf("delete-tags resource %s tag Keys=%v: %w", resource, keys, classify(err))
 	}
 	return nil
 }
 
 type address struct {
-	associationID string
-	allocationID  string
-	privateIP     string
-	publicIP      string
-	tags          map[string]string
+	associationID      string
+	allocationID       string
+	networkInterfaceID string
+	privateIP          string
+	// publicIP is the carrier IP of Wavelength Zone addresses and the customer-owned IP of CoIP pool addresses
+	publicIP              string
+	publicIPv4Pool        string
+	customerOwnedIPv4Pool string
+	networkBorderGroup    string
+	tags                  map[string]string
 }
 
 func toAddress(addr types.Address) address {
@@ -281,17 +456,45 @@ func toAddress(addr types.Address) address {
 	for _, t := range addr.Tags {
 		tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
 	}
+	publicIP := aws.ToString(addr.PublicIp)
+	if publicIP == "" {
+		publicIP = aws.ToString(addr.CarrierIp)
+	}
+	if publicIP == "" {
+		publicIP = aws.ToString(addr.CustomerOwnedIp)
+	}
 	return address{
-		associationID: aws.ToString(addr.AssociationId),
-		allocationID:  aws.ToString(addr.AllocationId),
-		privateIP:     aws.ToString(addr.PrivateIpAddress),
-		publicIP:      aws.ToString(addr.PublicIp),
-		tags:          tags,
+		associationID:         aws.ToString(addr.AssociationId),
+		allocationID:          aws.ToString(addr.AllocationId),
+		networkInterfaceID:    aws.ToString(addr.NetworkInterfaceId),
+		privateIP:             aws.ToString(addr.PrivateIpAddress),
+		publicIP:              publicIP,
+		publicIPv4Pool:        aws.ToString(addr.PublicIpv4Pool),
+		customerOwnedIPv4Pool: aws.ToString(addr.CustomerOwnedIpv4Pool),
+		networkBorderGroup:    aws.ToString(addr.NetworkBorderGroup),
+		tags:                  tags,
+	}
+}
+
+func (c EC2Client) describeAllocation(ctx context.Context, allocationID string) (address, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 describe-addresses --allocation-ids eipalloc-64d5890a
+	result, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		AllocationIds: []string{allocationID},
+	})
+	if err != nil {
+		return address{}, fmt.Errorf("describe address allocation-id %s: %w", allocationID, classify(err))
+	}
+	if len(result.Addresses) == 0 {
+		return address{}, newError(ErrNotFound, "no address found for allocation-id %s", allocationID)
 	}
+	return toAddress(result.Addresses[0]), nil
 }
 
-func (c EC2Client) describeAddresses(privateIP string, eniID string) ([]address, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) describeAddresses(ctx context.Context, privateIP string, eniID string) ([]address, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 
 	// aws ec2 describe-addresses --filters Name=private-ip-address,Values=10.2.21.154 Name=network-interface-id,Values=id-1a2b3c4d
@@ -308,7 +511,7 @@ func (c EC2Client) describeAddresses(privateIP string, eniID string) ([]address,
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("describe address private-ip-address %s network-interface-id %s", privateIP, eniID)
+		return nil, fmt.Errorf("describe address private-ip-address %s network-interface-id %s: %w", privateIP, eniID, classify(err))
 	}
 	var out []address
 	for _, v := range result.Addresses {
@@ -317,8 +520,8 @@ func (c EC2Client) describeAddresses(privateIP string, eniID string) ([]address,
 	return out, nil
 }
 
-func (c EC2Client) describePodAddresses(podKey string) ([]address, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) describePodAddresses(ctx context.Context, podKey string) ([]address, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 
 	result, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
@@ -334,7 +537,7 @@ func (c EC2Client) describePodAddresses(podKey string) ([]address, error) {
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("describe address pod %s: %v", podKey, err)
+		return nil, fmt.Errorf("describe address pod %s: %w", podKey, classify(err))
 	}
 	var out []address
 	for _, v := range result.Addresses {
@@ -345,75 +548,8 @@ func (c EC2Client) describePodAddresses(podKey string) ([]address, error) {
 	return out, nil
 }
 
-func (c EC2Client) allocateAddress(podKey, addressPoolId string) (allocationID string, publicIP string, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// aws ec2 allocate-address
-	allocatedResult, err := c.client.AllocateAddress(ctx, &ec2.AllocateAddressInput{
-		PublicIpv4Pool: aws.String(addressPoolId),
-		TagSpecifications: []types.TagSpecification{
-			{
-				ResourceType: types.ResourceTypeElasticIp,
-				Tags: []types.Tag{
-					{Key: aws.String(pkg.TagTypeKey), Value: aws.String(pkg.PodEIPAnnotationValueAuto)},
-					{Key: aws.String(pkg.TagClusterNameKey), Value: aws.String(c.clusterName)},
-					{Key: aws.String(pkg.TagPodKey), Value: aws.String(podKey)},
-				},
-			},
-		},
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("allocate address: %w", err)
-	}
-	return *allocatedResult.AllocationId, *allocatedResult.PublicIp, nil
-}
-
-func (c EC2Client) getTagAddress(tagKey string) (allocationID string, publicIP string, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// aws ec2 describe-addresses --filters Name=tag-key,Values=aws-pod-eip-controller --query 'Addresses[?AssociationId==null]'
-	describeResult, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
-		Filters: []types.Filter{
-			{Name: aws.String("tag-key"), Values: []string{tagKey}},
-		},
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("get tag address fail: %w", err)
-	}
-	if len(describeResult.Addresses) == 0 {
-		return "", "", fmt.Errorf("no address found for tag key %s", tagKey)
-	}
-	for _, addr := range describeResult.Addresses {
-		if addr.AssociationId == nil {
-			return *addr.AllocationId, *addr.PublicIp, nil
-		}
-	}
-	return "", "", fmt.Errorf("no address found for tag key %s and not attached", tagKey)
-}
-
-func (c EC2Client) getTagValueAddress(tagKey, value string) (allocationID string, publicIP string, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// aws ec2 describe-addresses --filters Name=tag:%,Values=demo/demo-0
-	describeResult, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
-		Filters: []types.Filter{
-			{Name: aws.String(fmt.Sprintf("tag:%s", tagKey)), Values: []string{value}},
-		},
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("get tag-value address fail: %w", err)
-	}
-	if len(describeResult.Addresses) == 0 {
-		return "", "", fmt.Errorf("no address found for tag-value key %s", tagKey)
-	}
-	return *describeResult.Addresses[0].AllocationId, *describeResult.Addresses[0].PublicIp, nil
-}
-
-func (c EC2Client) associateAddress(allocationId, eniID, privateIP string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) associateAddress(ctx context.Context, allocationId, eniID, privateIP string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 
 	// aws ec2 associate-address --allocation-id eipalloc-64d5890a --network-interface-id eni-1a2b3c4d --private-ip-address
@@ -422,34 +558,34 @@ func (c EC2Client) associateAddress(allocationId, eniID, privateIP string) error
 		NetworkInterfaceId: aws.String(eniID),
 		PrivateIpAddress:   aws.String(privateIP),
 	}); err != nil {
-		return fmt.Errorf("associate address allocation-id %s network-interface-id %s private-ip-address %s",
-			allocationId, eniID, privateIP)
+		return fmt.Errorf("associate address allocation-id %s network-interface-id %s private-ip-address %s: %w",
+			allocationId, eniID, privateIP, classify(err))
 	}
 	return nil
 }
 
-func (c EC2Client) disassociateAddress(associationID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) disassociateAddress(ctx context.Context, associationID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 
 	// aws ec2 disassociate-address --association-id eipassoc-2bebb745
 	if _, err := c.client.DisassociateAddress(ctx, &ec2.DisassociateAddressInput{
 		AssociationId: aws.String(associationID),
 	}); err != nil {
-		return fmt.Errorf("disassociate address association-id %s", associationID)
+		return fmt.Errorf("disassociate address association-id %s: %w", associationID, classify(err))
 	}
 	return nil
 }
 
-func (c EC2Client) releaseAddress(allocationID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c EC2Client) releaseAddress(ctx context.Context, allocationID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
 	defer cancel()
 
 	// aws ec2 release-address --allocation-id eipalloc-64d5890a
 	if _, err := c.client.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{
 		AllocationId: aws.String(allocationID),
 	}); err != nil {
-		return fmt.Errorf("release address allocation-id %s", allocationID)
+		return fmt.Errorf("release address allocation-id %s: %w", allocationID, classify(err))
 	}
 	return nil
 }
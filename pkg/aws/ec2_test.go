@@ -0,0 +1,329 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+const testClusterName = "test"
+
+var noOpLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+// testEC2 is an EC2 endpoint answering every action with the responses of the action in turn, the last one repeatedly
+type testEC2 struct {
+	lock      sync.Mutex
+	responses map[string][]string
+	// actions are the actions called in order and requests their parameters
+	actions  []string
+	requests []url.Values
+}
+
+func (e *testEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	action := r.Form.Get("Action")
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.actions = append(e.actions, action)
+	e.requests = append(e.requests, r.Form)
+	responses := e.responses[action]
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, testEC2Error("InvalidAction", "unexpected action "+action))
+		return
+	}
+	response := responses[0]
+	if len(responses) > 1 {
+		e.responses[action] = responses[1:]
+	}
+	if strings.HasPrefix(response, "<Response>") {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_, _ = fmt.Fprint(w, response)
+}
+
+func (e *testEC2) called() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]string(nil), e.actions...)
+}
+
+// requested returns the parameters of the calls of the action in order
+func (e *testEC2) requested(action string) []url.Values {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	var requests []url.Values
+	for i, called := range e.actions {
+		if called == action {
+			requests = append(requests, e.requests[i])
+		}
+	}
+	return requests
+}
+
+// newTestEC2Client returns a client of an EC2 endpoint with the responses by action, calls are not retried
+func newTestEC2Client(t *testing.T, responses map[string][]string, optFns ...func(*ec2.Options)) (EC2Client, *testEC2) {
+	endpoint := &testEC2{responses: responses}
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+	options := append([]func(*ec2.Options){func(o *ec2.Options) {
+		o.RetryMaxAttempts = 1
+	}}, optFns...)
+	client := ec2.New(ec2.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	}, options...)
+	return EC2Client{
+		logger:      noOpLogger,
+		region:      "us-east-1",
+		client:      client,
+		clusterName: testClusterName,
+		callTimeout: 5 * time.Second,
+	}, endpoint
+}
+
+type testAddress struct {
+	allocationID string
+	publicIP     string
+	// associationID, eniID and privateIP are set for associated addresses
+	associationID string
+	eniID         string
+	privateIP     string
+	tags          map[string]string
+}
+
+func testDescribeAddresses(addrs ...testAddress) string {
+	var items strings.Builder
+	for _, addr := range addrs {
+		var tags strings.Builder
+		for k, v := range addr.tags {
+			fmt.Fprintf(&tags, "<item><key>%s</key><value>%s</value></item>", k, v)
+		}
+		fmt.Fprintf(&items, "<item><publicIp>%s</publicIp><allocationId>%s</allocationId><domain>vpc</domain>", addr.publicIP, addr.allocationID)
+		if addr.associationID != "" {
+			fmt.Fprintf(&items, "<associationId>%s</associationId><networkInterfaceId>%s</networkInterfaceId><privateIpAddress>%s</privateIpAddress>",
+				addr.associationID, addr.eniID, addr.privateIP)
+		}
+		fmt.Fprintf(&items, "<tagSet>%s</tagSet></item>", tags.String())
+	}
+	return fmt.Sprintf(`<DescribeAddressesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>1</requestId><addressesSet>%s</addressesSet></DescribeAddressesResponse>`, items.String())
+}
+
+func testAllocateAddress(allocationID, publicIP string) string {
+	return testAllocateIP(allocationID, "publicIp", publicIP)
+}
+
+// testAllocateIP returns an AllocateAddress response with the IP in the element, e.g. carrierIp or customerOwnedIp
+func testAllocateIP(allocationID, element, ip string) string {
+	return fmt.Sprintf(`<AllocateAddressResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>1</requestId><%s>%s</%s><domain>vpc</domain><allocationId>%s</allocationId></AllocateAddressResponse>`,
+		element, ip, element, allocationID)
+}
+
+// testAllocatedTags returns the tags of the tag specification of an AllocateAddress request
+func testAllocatedTags(request url.Values) map[string]string {
+	tags := map[string]string{}
+	for i := 1; request.Has(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i)); i++ {
+		tags[request.Get(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i))] = request.Get(fmt.Sprintf("TagSpecification.1.Tag.%d.Value", i))
+	}
+	return tags
+}
+
+func testDescribeAvailabilityZones(name, zoneType, networkBorderGroup string) string {
+	return fmt.Sprintf(`<DescribeAvailabilityZonesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>1</requestId><availabilityZoneInfo><item><zoneName>%s</zoneName><zoneType>%s</zoneType><networkBorderGroup>%s</networkBorderGroup></item></availabilityZoneInfo></DescribeAvailabilityZonesResponse>`,
+		name, zoneType, networkBorderGroup)
+}
+
+func testDescribeNetworkInterfaces(eniID, zone string) string {
+	return fmt.Sprintf(`<DescribeNetworkInterfacesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>1</requestId><networkInterfaceSet><item><networkInterfaceId>%s</networkInterfaceId><availabilityZone>%s</availabilityZone><status>in-use</status></item></networkInterfaceSet></DescribeNetworkInterfacesResponse>`, eniID, zone)
+}
+
+func testEC2Response(action string) string {
+	return fmt.Sprintf(`<%sResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>1</requestId><return>true</return></%sResponse>`, action, action)
+}
+
+func testEC2Error(code, message string) string {
+	return fmt.Sprintf(`<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors><RequestID>1</RequestID></Response>`, code, message)
+}
+
+// testAutoOptions returns the options of an auto mode pod with the annotations
+func testAutoOptions(annotations map[string]string) AssociateAddressOptions {
+	return AssociateAddressOptions{PodKey: "default/test", PECType: pkg.PodEIPAnnotationValueAuto, Annotations: annotations}
+}
+
+func TestEC2Client_verifyAssociation(t *testing.T) {
+	associated := testAddress{allocationID: "eipalloc-1", publicIP: "1.1.1.1", associationID: "eipassoc-1", eniID: "eni-1", privateIP: "10.0.0.1"}
+
+	t.Run("given address associated to the private IP when association is verified then it succeeds", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(associated)},
+		})
+		c.verifyTimeout = time.Second
+
+		assert.NoError(t, c.verifyAssociation(context.Background(), "eipalloc-1", "eni-1", "10.0.0.1"))
+	})
+
+	t.Run("given association becoming visible when association is verified then it succeeds", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(testAddress{allocationID: "eipalloc-1", publicIP: "1.1.1.1"}), testDescribeAddresses(associated)},
+		})
+		c.verifyTimeout = 5 * time.Second
+
+		assert.NoError(t, c.verifyAssociation(context.Background(), "eipalloc-1", "eni-1", "10.0.0.1"))
+		assert.Equal(t, []string{"DescribeAddresses", "DescribeAddresses"}, endpoint.called())
+	})
+
+	t.Run("given address associated to another private IP when association is verified then a conflict is returned", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(associated)},
+		})
+		c.verifyTimeout = time.Millisecond
+
+		err := c.verifyAssociation(context.Background(), "eipalloc-1", "eni-1", "10.0.0.2")
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("given verification disabled when association is verified then EC2 is not called", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, nil)
+
+		assert.NoError(t, c.verifyAssociation(context.Background(), "eipalloc-1", "eni-1", "10.0.0.1"))
+		assert.Empty(t, endpoint.called())
+	})
+}
+
+func TestEC2Client_AssociateAddress(t *testing.T) {
+	free := testAddress{allocationID: "eipalloc-1", publicIP: "1.1.1.1", tags: map[string]string{"pool": "egress"}}
+	tagged := testAddress{allocationID: "eipalloc-1", publicIP: "1.1.1.1", tags: map[string]string{
+		"pool":                "egress",
+		pkg.TagPodKey:         "default/web",
+		pkg.TagClusterNameKey: testClusterName,
+		pkg.TagTypeKey:        pkg.PodEIPAnnotationValueFixedTag,
+	}}
+	options := AssociateAddressOptions{
+		PodKey:      "default/web",
+		PodIP:       "10.0.0.1",
+		PECType:     pkg.PodEIPAnnotationValueFixedTag,
+		Annotations: map[string]string{pkg.PodAddressFixedTagAnnotationKey: "pool=egress"},
+	}
+
+	t.Run("given acquired address when association fails then the address is untagged", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeNetworkInterfaces": {testDescribeNetworkInterfaces("eni-1", "us-east-1a")},
+			"DescribeAddresses":         {testDescribeAddresses(), testDescribeAddresses(free), testDescribeAddresses(tagged)},
+			"CreateTags":                {testEC2Response("CreateTags")},
+			"AssociateAddress":          {testEC2Error("UnauthorizedOperation", "not authorized")},
+			"DeleteTags":                {testEC2Response("DeleteTags")},
+		})
+
+		_, err := c.AssociateAddress(context.Background(), options)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		deleted := endpoint.requested("DeleteTags")
+		if assert.Len(t, deleted, 1) {
+			assert.Equal(t, "eipalloc-1", deleted[0].Get("ResourceId.1"))
+			assert.Equal(t, pkg.TagPodKey, deleted[0].Get("Tag.1.Key"))
+		}
+		assert.NotContains(t, endpoint.called(), "DisassociateAddress")
+	})
+
+	t.Run("given acquired address when association and rollback fail then both errors are returned", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeNetworkInterfaces": {testDescribeNetworkInterfaces("eni-1", "us-east-1a")},
+			"DescribeAddresses":         {testDescribeAddresses(), testDescribeAddresses(free), testDescribeAddresses(tagged)},
+			"CreateTags":                {testEC2Response("CreateTags")},
+			"AssociateAddress":          {testEC2Error("UnauthorizedOperation", "not authorized")},
+			"DeleteTags":                {testEC2Error("RequestLimitExceeded", "throttled")},
+		})
+
+		_, err := c.AssociateAddress(context.Background(), options)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.ErrorIs(t, err, ErrThrottled)
+	})
+}
+
+func TestEC2Client_displaceAddresses(t *testing.T) {
+	owned := testAddress{allocationID: "eipalloc-1", publicIP: "1.1.1.1", associationID: "eipassoc-1", eniID: "eni-1", privateIP: "10.0.0.1", tags: map[string]string{
+		pkg.TagPodKey:         "default/old",
+		pkg.TagClusterNameKey: testClusterName,
+		pkg.TagTypeKey:        pkg.PodEIPAnnotationValueFixedTagValue,
+	}}
+	foreign := testAddress{allocationID: "eipalloc-2", publicIP: "2.2.2.2", associationID: "eipassoc-2", eniID: "eni-1", privateIP: "10.0.0.1"}
+
+	t.Run("given address of another pod when addresses are displaced then it is disassociated and returned", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses":   {testDescribeAddresses(owned)},
+			"DisassociateAddress": {testEC2Response("DisassociateAddress")},
+			"DeleteTags":          {testEC2Response("DeleteTags")},
+		})
+
+		result, err := c.displaceAddresses(context.Background(), "default/new", "10.0.0.1", "eni-1")
+		assert.NoError(t, err)
+		assert.Equal(t, []DisplacedAddress{{PublicIP: "1.1.1.1", AllocationID: "eipalloc-1", Owner: "default/old"}}, result.Displaced)
+		assert.Equal(t, []string{"DescribeAddresses", "DisassociateAddress", "DeleteTags"}, endpoint.called())
+	})
+
+	t.Run("given foreign address when replacing is disabled then a conflict is returned", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(foreign)},
+		})
+
+		result, err := c.displaceAddresses(context.Background(), "default/new", "10.0.0.1", "eni-1")
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Empty(t, result.Displaced)
+		assert.Equal(t, []string{"DescribeAddresses"}, endpoint.called())
+	})
+
+	t.Run("given foreign address when replacing is enabled then it is disassociated but not returned", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses":   {testDescribeAddresses(foreign)},
+			"DisassociateAddress": {testEC2Response("DisassociateAddress")},
+		})
+		c.replaceForeign = true
+
+		result, err := c.displaceAddresses(context.Background(), "default/new", "10.0.0.1", "eni-1")
+		assert.NoError(t, err)
+		assert.Equal(t, []DisplacedAddress{{PublicIP: "2.2.2.2", AllocationID: "eipalloc-2"}}, result.Displaced)
+		assert.Equal(t, []string{"DescribeAddresses", "DisassociateAddress"}, endpoint.called())
+	})
+
+	t.Run("given displaced address when a later address fails then the displaced address is returned with the error", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses":   {testDescribeAddresses(owned, foreign)},
+			"DisassociateAddress": {testEC2Response("DisassociateAddress")},
+			"DeleteTags":          {testEC2Response("DeleteTags")},
+		})
+
+		result, err := c.displaceAddresses(context.Background(), "default/new", "10.0.0.1", "eni-1")
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, []DisplacedAddress{{PublicIP: "1.1.1.1", AllocationID: "eipalloc-1", Owner: "default/old"}}, result.Displaced)
+	})
+
+	t.Run("given address which can not be returned when addresses are displaced then it is displaced with the error", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses":   {testDescribeAddresses(owned)},
+			"DisassociateAddress": {testEC2Response("DisassociateAddress")},
+			"DeleteTags":          {testEC2Error("UnauthorizedOperation", "not authorized")},
+		})
+
+		result, err := c.displaceAddresses(context.Background(), "default/new", "10.0.0.1", "eni-1")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Len(t, result.Displaced, 1)
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// Kinds of EC2 failures, use errors.Is to check the kind of an error returned by EC2Client
+var (
+	ErrThrottled        = errors.New("throttled")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrNotFound         = errors.New("not found")
+	ErrInvalidParameter = errors.New("invalid parameter")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrConflict         = errors.New("conflict")
+	// ErrInsufficientCapacity is returned when an address pool has no address left
+	ErrInsufficientCapacity = errors.New("insufficient capacity")
+)
+
+// Error is an EC2 API error classified by its kind
+type Error struct {
+	Kind error
+	// Code is the EC2 API error code
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Retryable returns true if retrying the call can succeed without changes to the pod or the account
+func (e *Error) Retryable() bool {
+	return e.Kind == ErrThrottled || e.Kind == ErrConflict || e.Kind == ErrInsufficientCapacity
+}
+
+// Throttled returns true if the call was rejected because of the EC2 request rate
+func (e *Error) Throttled() bool {
+	return e.Kind == ErrThrottled
+}
+
+// classify wraps an EC2 API error with its kind, errors which can't be classified are returned unchanged
+func classify(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	code := apiErr.ErrorCode()
+	kind := errorKind(code)
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Code: code, Err: err}
+}
+
+func errorKind(code string) error {
+	switch code {
+	case "RequestLimitExceeded", "Throttling", "ThrottlingException", "RequestThrottled", "RequestThrottledException", "TooManyRequestsException":
+		return ErrThrottled
+	case "UnauthorizedOperation", "AuthFailure", "Blocked", "OptInRequired", "SignatureDoesNotMatch", "InvalidClientTokenId":
+		return ErrUnauthorized
+	case "Resource.AlreadyAssociated", "InvalidIPAddress.InUse", "InvalidAddress.Locked", "IncorrectState", "IncorrectInstanceState":
+		return ErrConflict
+	case "InvalidParameter", "InvalidParameterValue", "InvalidParameterCombination", "MissingParameter", "UnknownParameter", "InvalidFilter":
+		return ErrInvalidParameter
+	}
+	switch {
+	case strings.HasSuffix(code, "LimitExceeded"):
+		return ErrQuotaExceeded
+	case strings.HasSuffix(code, ".NotFound"):
+		return ErrNotFound
+	case strings.HasSuffix(code, ".Malformed"):
+		return ErrInvalidParameter
+	case strings.HasPrefix(code, "Insufficient"):
+		return ErrInsufficientCapacity
+	}
+	return nil
+}
+
+// newError returns an error of the kind which is not coming from the EC2 API
+func newError(kind error, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// PoolExhaustedError is returned when a fixed-tag pool does not have any unassociated address left
+type PoolExhaustedError struct {
+	// Selector is the fixed-tag annotation of the pool, a tag key or a selector over the address tags
+	Selector string
+	// Total are the addresses of the pool, all of them are in use
+	Total int
+}
+
+func (e PoolExhaustedError) Error() string {
+	if e.Total == 0 {
+		return fmt.Sprintf("no address found for tag selector %s", e.Selector)
+	}
+	return fmt.Sprintf("no address found for tag selector %s and not attached, all %d in use", e.Selector, e.Total)
+}
+
+// PendingPool returns the pool the pod has to wait on until an address becomes available
+func (e PoolExhaustedError) PendingPool() string {
+	return e.Selector
+}
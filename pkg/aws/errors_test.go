@@ -0,0 +1,91 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKind(t *testing.T) {
+	t.Run("given EC2 error codes when they are classified then their kind is returned", func(t *testing.T) {
+		for code, kind := range map[string]error{
+			"RequestLimitExceeded":                     ErrThrottled,
+			"Throttling":                               ErrThrottled,
+			"UnauthorizedOperation":                    ErrUnauthorized,
+			"OptInRequired":                            ErrUnauthorized,
+			"Resource.AlreadyAssociated":               ErrConflict,
+			"InvalidIPAddress.InUse":                   ErrConflict,
+			"InvalidParameterValue":                    ErrInvalidParameter,
+			"InvalidAllocationID.Malformed":            ErrInvalidParameter,
+			"AddressLimitExceeded":                     ErrQuotaExceeded,
+			"InvalidAllocationID.NotFound":             ErrNotFound,
+			"InsufficientAddressCapacity":              ErrInsufficientCapacity,
+			"InsufficientFreeAddressesInSubnet":        ErrInsufficientCapacity,
+			"InvalidNetworkInterfaceID.NotFound":       ErrNotFound,
+			"VcpuLimitExceeded":                        ErrQuotaExceeded,
+			"InvalidParameterCombination":              ErrInvalidParameter,
+			"InvalidAssociationID.NotFound":            ErrNotFound,
+			"RequestThrottledException":                ErrThrottled,
+			"InvalidAddress.Locked":                    ErrConflict,
+			"InvalidPublicIpv4PoolID.Malformed":        ErrInvalidParameter,
+			"InvalidCustomerOwnedIpv4PoolID.Malformed": ErrInvalidParameter,
+		} {
+			assert.Equal(t, kind, errorKind(code), code)
+		}
+	})
+
+	t.Run("given unknown EC2 error code when it is classified then it has no kind", func(t *testing.T) {
+		assert.Nil(t, errorKind("InternalError"))
+		assert.Nil(t, errorKind(""))
+	})
+}
+
+func TestClassify(t *testing.T) {
+	t.Run("given EC2 API error when it is classified then the error has its kind and code", func(t *testing.T) {
+		apiErr := &smithy.GenericAPIError{Code: "InvalidAllocationID.NotFound", Message: "not found"}
+		err := classify(fmt.Errorf("operation error: %w", apiErr))
+
+		var classified *Error
+		assert.True(t, errors.As(err, &classified))
+		assert.Equal(t, "InvalidAllocationID.NotFound", classified.Code)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, err, apiErr)
+		assert.False(t, classified.Retryable())
+	})
+
+	t.Run("given throttling error when it is classified then it is retryable and throttled", func(t *testing.T) {
+		var classified *Error
+		assert.True(t, errors.As(classify(&smithy.GenericAPIError{Code: "RequestLimitExceeded"}), &classified))
+		assert.True(t, classified.Retryable())
+		assert.True(t, classified.Throttled())
+	})
+
+	t.Run("given error which is not an EC2 API error when it is classified then it is returned unchanged", func(t *testing.T) {
+		err := errors.New("connection reset")
+		assert.Equal(t, err, classify(err))
+	})
+
+	t.Run("given EC2 API error of unknown code when it is classified then it is returned unchanged", func(t *testing.T) {
+		err := &smithy.GenericAPIError{Code: "InternalError"}
+		assert.Equal(t, err, classify(err))
+	})
+}
+
+func TestPoolExhaustedError(t *testing.T) {
+	t.Run("given pool without addresses when the error is formatted then no address is found", func(t *testing.T) {
+		err := PoolExhaustedError{Selector: "pool=egress"}
+		assert.Equal(t, "no address found for tag selector pool=egress", err.Error())
+		assert.Equal(t, "pool=egress", err.PendingPool())
+	})
+
+	t.Run("given pool with addresses in use when the error is formatted then the total is included", func(t *testing.T) {
+		err := PoolExhaustedError{Selector: "pool=egress", Total: 3}
+		assert.Equal(t, "no address found for tag selector pool=egress and not attached, all 3 in use", err.Error())
+	})
+}
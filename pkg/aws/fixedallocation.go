@@ -0,0 +1,109 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func init() {
+	RegisterAddressProvider(fixedAllocationProvider{})
+}
+
+// fixedAllocationProvider takes the address with the allocation ID or public IP of the pod annotation and untags it on deletion
+type fixedAllocationProvider struct{}
+
+func (fixedAllocationProvider) Type() string {
+	return pkg.PodEIPAnnotationValueFixedAllocation
+}
+
+func (fixedAllocationProvider) DesiredState() []StateKey {
+	return []StateKey{{Annotation: pkg.PodAddressFixedAllocationAnnotationKey, Label: pkg.PodFixedAllocationLabel}}
+}
+
+// LockKey is empty, the annotation may be the allocation ID or the public IP of the address, so Acquire locks the
+// allocation ID once it is resolved
+func (fixedAllocationProvider) LockKey(AssociateAddressOptions) string {
+	return ""
+}
+
+// Acquire tags the address with the pod under the lock of its allocation ID, once tagged it is not taken by other pods
+func (fixedAllocationProvider) Acquire(ctx context.Context, c EC2Client, options AssociateAddressOptions) (AcquiredAddress, error) {
+	allocation := options.Annotations[pkg.PodAddressFixedAllocationAnnotationKey]
+	resolved, err := c.describeFixedAllocation(ctx, allocation)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	key := "fixed-allocation/" + resolved.allocationID
+	keyLocks.Lock(key)
+	defer keyLocks.Unlock(key)
+
+	// described again, another pod may have taken the address while waiting for the lock
+	addr, err := c.describeFixedAllocation(ctx, resolved.allocationID)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	if owner, ok := addr.tags[pkg.TagPodKey]; ok && (owner != options.PodKey || addr.tags[pkg.TagClusterNameKey] != c.clusterName) {
+		return AcquiredAddress{}, newError(ErrConflict, "address %s (allocation-id %s) is held by %s pod of %q cluster", addr.publicIP, addr.allocationID, owner, addr.tags[pkg.TagClusterNameKey])
+	}
+	// e.g. warm pool, parked and unassigned workload addresses are not tagged with a pod
+	if heldByController(addr) {
+		return AcquiredAddress{}, newError(ErrConflict, "address %s (allocation-id %s) is held by another mode of the controller", addr.publicIP, addr.allocationID)
+	}
+	// addresses of the pod private IP are displaced before, an association is to another private IP
+	if addr.associationID != "" {
+		return AcquiredAddress{}, newError(ErrConflict, "address %s (allocation-id %s) is associated to network-interface-id %s private-ip-address %s",
+			addr.publicIP, addr.allocationID, addr.networkInterfaceID, addr.privateIP)
+	}
+	if err := c.tagPodAddress(ctx, addr.allocationID, options.PodKey, pkg.PodEIPAnnotationValueFixedAllocation); err != nil {
+		return AcquiredAddress{}, err
+	}
+	return AcquiredAddress{AllocationID: addr.allocationID, PublicIP: addr.publicIP}, nil
+}
+
+// Release untags the address, it is available to the fixed-tag pools matching its tags again
+func (fixedAllocationProvider) Release(ctx context.Context, c EC2Client, addr address) ([]string, error) {
+	if err := c.untagPodAddress(ctx, addr.allocationID); err != nil {
+		return nil, err
+	}
+	return exhausted.matching(addr.tags), nil
+}
+
+// describeFixedAllocation returns the VPC address of the account with the allocation ID or public IP
+func (c EC2Client) describeFixedAllocation(ctx context.Context, allocation string) (address, error) {
+	input := &ec2.DescribeAddressesInput{}
+	switch {
+	case strings.HasPrefix(allocation, "eipalloc-"):
+		input.AllocationIds = []string{allocation}
+	case net.ParseIP(allocation).To4() != nil:
+		input.PublicIps = []string{allocation}
+	default:
+		return address{}, newError(ErrInvalidParameter, "fixed allocation %q is neither an allocation ID nor a public IPv4 address", allocation)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 describe-addresses --allocation-ids eipalloc-64d5890a
+	// aws ec2 describe-addresses --public-ips 123.123.123.123
+	result, err := c.client.DescribeAddresses(ctx, input)
+	if err != nil {
+		return address{}, fmt.Errorf("describe address fixed allocation %s: %w", allocation, classify(err))
+	}
+	if len(result.Addresses) == 0 {
+		return address{}, newError(ErrNotFound, "no address found for fixed allocation %s", allocation)
+	}
+	if result.Addresses[0].Domain != types.DomainTypeVpc {
+		return address{}, newError(ErrInvalidParameter, "fixed allocation %s is not a VPC address", allocation)
+	}
+	return toAddress(result.Addresses[0]), nil
+}
@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestFixedAllocationProvider_Acquire(t *testing.T) {
+	options := func(allocation string) AssociateAddressOptions {
+		return AssociateAddressOptions{
+			PodKey:      "default/test",
+			PECType:     pkg.PodEIPAnnotationValueFixedAllocation,
+			Annotations: map[string]string{pkg.PodAddressFixedAllocationAnnotationKey: allocation},
+		}
+	}
+	free := testAddress{allocationID: "eipalloc-1", publicIP: "1.1.1.1"}
+
+	t.Run("given public IP annotation when address is acquired then it is tagged by its allocation ID", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(free)},
+			"CreateTags":        {testEC2Response("CreateTags")},
+		})
+
+		acquired, err := fixedAllocationProvider{}.Acquire(context.Background(), c, options("1.1.1.1"))
+		assert.NoError(t, err)
+		assert.Equal(t, AcquiredAddress{AllocationID: "eipalloc-1", PublicIP: "1.1.1.1"}, acquired)
+		assert.Equal(t, []string{"DescribeAddresses", "DescribeAddresses", "CreateTags"}, endpoint.called())
+	})
+
+	t.Run("given address of the same pod when address is acquired again then it is tagged", func(t *testing.T) {
+		owned := free
+		owned.tags = map[string]string{pkg.TagPodKey: "default/test", pkg.TagClusterNameKey: testClusterName}
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(owned)},
+			"CreateTags":        {testEC2Response("CreateTags")},
+		})
+
+		_, err := fixedAllocationProvider{}.Acquire(context.Background(), c, options("eipalloc-1"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("given address taken by another pod while waiting for the lock when address is acquired then a conflict is returned", func(t *testing.T) {
+		taken := free
+		taken.tags = map[string]string{pkg.TagPodKey: "default/other", pkg.TagClusterNameKey: testClusterName}
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(free), testDescribeAddresses(taken)},
+		})
+
+		_, err := fixedAllocationProvider{}.Acquire(context.Background(), c, options("1.1.1.1"))
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, []string{"DescribeAddresses", "DescribeAddresses"}, endpoint.called())
+	})
+
+	t.Run("given addresses which are not available when address is acquired then a conflict is returned", func(t *testing.T) {
+		for name, addr := range map[string]testAddress{
+			"warm pool": {allocationID: "eipalloc-1", publicIP: "1.1.1.1", tags: map[string]string{pkg.TagWarmPoolKey: "amazon"}},
+			"parked": {allocationID: "eipalloc-1", publicIP: "1.1.1.1", tags: map[string]string{
+				pkg.TagStickyKey: "statefulset/default/web-0", pkg.TagTypeKey: pkg.PodEIPAnnotationValueAuto,
+			}},
+			"workload": {allocationID: "eipalloc-1", publicIP: "1.1.1.1", tags: map[string]string{
+				pkg.TagWorkloadKey: "Deployment/default/web", pkg.TagTypeKey: pkg.PodEIPAnnotationValueWorkload,
+			}},
+			"associated": {allocationID: "eipalloc-1", publicIP: "1.1.1.1", associationID: "eipassoc-1", eniID: "eni-2", privateIP: "10.0.0.2"},
+			"other cluster": {allocationID: "eipalloc-1", publicIP: "1.1.1.1", tags: map[string]string{
+				pkg.TagPodKey: "default/test", pkg.TagClusterNameKey: "other",
+			}},
+		} {
+			c, endpoint := newTestEC2Client(t, map[string][]string{
+				"DescribeAddresses": {testDescribeAddresses(addr)},
+			})
+
+			_, err := fixedAllocationProvider{}.Acquire(context.Background(), c, options("eipalloc-1"))
+			assert.ErrorIs(t, err, ErrConflict, name)
+			assert.NotContains(t, endpoint.called(), "CreateTags", name)
+		}
+	})
+
+	t.Run("given annotation which is neither an allocation ID nor a public IP when address is acquired then it is invalid", func(t *testing.T) {
+		for _, allocation := range []string{"", "eip-1", "2001:db8::1", "1.1.1"} {
+			c, endpoint := newTestEC2Client(t, nil)
+
+			_, err := fixedAllocationProvider{}.Acquire(context.Background(), c, options(allocation))
+			assert.ErrorIs(t, err, ErrInvalidParameter, allocation)
+			assert.Empty(t, endpoint.called(), allocation)
+		}
+	})
+}
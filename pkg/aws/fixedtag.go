@@ -0,0 +1,281 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+var exhausted = newExhaustedPools()
+
+func init() {
+	RegisterAddressProvider(fixedTagProvider{})
+}
+
+// fixedTagProvider takes an unassociated address matching the tag selector of the pod and untags it on deletion, the
+// addresses matching the same selector are a pool shared by the pods
+type fixedTagProvider struct{}
+
+func (fixedTagProvider) Type() string {
+	return pkg.PodEIPAnnotationValueFixedTag
+}
+
+func (fixedTagProvider) DesiredState() []StateKey {
+	return []StateKey{{Annotation: pkg.PodAddressFixedTagAnnotationKey, Label: pkg.PodFixedTagLabel}}
+}
+
+// LockKey is the mode, so the same unassociated address is not taken by multiple pods, the selectors of the pods may
+// overlap, e.g. pool=egress and pool in (egress,ingress)
+func (fixedTagProvider) LockKey(AssociateAddressOptions) string {
+	return pkg.PodEIPAnnotationValueFixedTag
+}
+
+func (fixedTagProvider) Acquire(ctx context.Context, c EC2Client, options AssociateAddressOptions) (AcquiredAddress, error) {
+	pool := options.Annotations[pkg.PodAddressFixedTagAnnotationKey]
+	strategy := options.Annotations[pkg.PodAddressFixedTagStrategyAnnotationKey]
+	addr, err := c.getTagAddress(ctx, pool, strategy)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	if err := c.tagPodAddress(ctx, addr.allocationID, options.PodKey, pkg.PodEIPAnnotationValueFixedTag); err != nil {
+		return AcquiredAddress{}, err
+	}
+	return AcquiredAddress{AllocationID: addr.allocationID, PublicIP: addr.publicIP}, nil
+}
+
+// Release untags the address and records when it was released for the least-recently-used strategy
+func (fixedTagProvider) Release(ctx context.Context, c EC2Client, addr address) ([]string, error) {
+	if err := c.untagPodAddress(ctx, addr.allocationID); err != nil {
+		return nil, err
+	}
+	if err := c.createTag(ctx, addr.allocationID, map[string]string{
+		pkg.TagReleasedAtKey: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return nil, err
+	}
+	return exhausted.matching(addr.tags), nil
+}
+
+// poolSelector selects the addresses of a fixed-tag pool by their tags
+type poolSelector struct {
+	selector labels.Selector
+	// tagKey is the tag key of an annotation which is not a valid selector, e.g. a tag key with a colon, it selects
+	// the addresses with the tag
+	tagKey string
+}
+
+func (s poolSelector) matches(tags map[string]string) bool {
+	if s.selector == nil {
+		_, ok := tags[s.tagKey]
+		return ok
+	}
+	return s.selector.Matches(labels.Set(tags))
+}
+
+// parsePoolSelector parses the fixed-tag annotation, a tag key or a label selector over the address tags, e.g.
+// pool=egress,region-group in (eu). An annotation which is not a valid selector is a tag key. A selector needs an
+// equality, set or existence requirement, so the pool is filtered by EC2 and not every address of the account matches.
+func parsePoolSelector(pool string) (poolSelector, error) {
+	if strings.TrimSpace(pool) == "" {
+		return poolSelector{}, newError(ErrInvalidParameter, "fixed tag selector is empty")
+	}
+	selector, err := labels.Parse(pool)
+	if err != nil {
+		return poolSelector{tagKey: pool}, nil
+	}
+	s := poolSelector{selector: selector}
+	if len(s.filters()) == 0 {
+		return poolSelector{}, newError(ErrInvalidParameter, "fixed tag selector %q has no equality, set or existence requirement", pool)
+	}
+	return s, nil
+}
+
+// filters returns the EC2 filters of the selector requirements which can be filtered server-side, the address
+// tags still have to be matched with the selector
+func (s poolSelector) filters() []types.Filter {
+	if s.selector == nil {
+		return []types.Filter{{Name: aws.String("tag-key"), Values: []string{s.tagKey}}}
+	}
+	requirements, _ := s.selector.Requirements()
+	var filters []types.Filter
+	seen := make(map[string]bool)
+	for _, r := range requirements {
+		var name string
+		var values []string
+		switch r.Operator() {
+		case selection.Exists:
+			// tag-key filters of the same name would match any of the keys
+			name, values = "tag-key", []string{r.Key()}
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			name, values = fmt.Sprintf("tag:%s", r.Key()), r.Values().List()
+		default:
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		filters = append(filters, types.Filter{Name: aws.String(name), Values: values})
+	}
+	return filters
+}
+
+// heldByController returns whether the address is held by another mode of the controller, e.g. in a warm pool or
+// parked, it is not part of any fixed-tag pool
+func heldByController(addr address) bool {
+	for _, key := range []string{pkg.TagWarmPoolKey, pkg.TagStickyKey, pkg.TagWorkloadKey} {
+		if _, ok := addr.tags[key]; ok {
+			return true
+		}
+	}
+	switch addr.tags[pkg.TagTypeKey] {
+	case pkg.PodEIPAnnotationValueAuto, pkg.PodEIPAnnotationValueWorkload:
+		return true
+	}
+	return false
+}
+
+// inUse returns whether the address of a pool is associated or tagged with a pod which is associating it
+func inUse(addr address) bool {
+	if addr.associationID != "" {
+		return true
+	}
+	for _, key := range []string{pkg.TagPodKey, pkg.TagTypeKey} {
+		if _, ok := addr.tags[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c EC2Client) getTagAddress(ctx context.Context, pool, strategy string) (address, error) {
+	selector, err := parsePoolSelector(pool)
+	if err != nil {
+		return address{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 describe-addresses --filters Name=tag-key,Values=aws-pod-eip-controller --query 'Addresses[?AssociationId==null]'
+	describeResult, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		Filters: selector.filters(),
+	})
+	if err != nil {
+		return address{}, fmt.Errorf("get tag address fail: %w", classify(err))
+	}
+	var total int
+	var free []address
+	for _, v := range describeResult.Addresses {
+		addr := toAddress(v)
+		if !selector.matches(addr.tags) || heldByController(addr) {
+			continue
+		}
+		total++
+		if !inUse(addr) {
+			free = append(free, addr)
+		}
+	}
+	if len(free) == 0 {
+		// every address in the pool is in use
+		exhausted.add(pool, selector)
+		return address{}, PoolExhaustedError{
+			Selector: pool,
+			Total:    total,
+		}
+	}
+	exhausted.remove(pool)
+	return selectAddress(free, strategy)
+}
+
+// selectAddress returns one of the unassociated addresses of a pool with the strategy, first in API order by default
+func selectAddress(addrs []address, strategy string) (address, error) {
+	switch strategy {
+	case "", pkg.FixedTagStrategyFirst:
+		return addrs[0], nil
+	case pkg.FixedTagStrategyRandom:
+		return addrs[rand.IntN(len(addrs))], nil
+	case pkg.FixedTagStrategyLeastRecentlyUsed:
+		// addresses which were never released have no valid time and come first
+		sort.SliceStable(addrs, func(i, j int) bool {
+			ti, _ := time.Parse(time.RFC3339, addrs[i].tags[pkg.TagReleasedAtKey])
+			tj, _ := time.Parse(time.RFC3339, addrs[j].tags[pkg.TagReleasedAtKey])
+			return ti.Before(tj)
+		})
+		return addrs[0], nil
+	case pkg.FixedTagStrategyLowestIP:
+		sort.SliceStable(addrs, func(i, j int) bool {
+			ipi, _ := netip.ParseAddr(addrs[i].publicIP)
+			ipj, _ := netip.ParseAddr(addrs[j].publicIP)
+			return ipi.Less(ipj)
+		})
+		return addrs[0], nil
+	}
+	return address{}, newError(ErrInvalidParameter, "unsupported fixed tag strategy %s", strategy)
+}
+
+// tagPodAddress tags an existing address with the pod, so it is found and returned on pod deletion
+func (c EC2Client) tagPodAddress(ctx context.Context, allocationID, podKey, pecType string) error {
+	return c.createTag(ctx, allocationID, map[string]string{
+		pkg.TagPodKey:         podKey,
+		pkg.TagClusterNameKey: c.clusterName,
+		pkg.TagTypeKey:        pecType,
+	})
+}
+
+// untagPodAddress deletes the tags of tagPodAddress
+func (c EC2Client) untagPodAddress(ctx context.Context, allocationID string) error {
+	return c.deleteTag(ctx, allocationID, []string{pkg.TagPodKey, pkg.TagTypeKey, pkg.TagClusterNameKey})
+}
+
+// exhaustedPools are the selectors of the fixed-tag pools which had no unassociated address left, so the pools a
+// released address went back to can be found by its tags
+type exhaustedPools struct {
+	lock      sync.Mutex
+	selectors map[string]poolSelector
+}
+
+func newExhaustedPools() *exhaustedPools {
+	return &exhaustedPools{selectors: make(map[string]poolSelector)}
+}
+
+func (e *exhaustedPools) add(pool string, selector poolSelector) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.selectors[pool] = selector
+}
+
+func (e *exhaustedPools) remove(pool string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.selectors, pool)
+}
+
+// matching returns the exhausted pools whose selector matches the address tags
+func (e *exhaustedPools) matching(tags map[string]string) []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	var pools []string
+	for pool, selector := range e.selectors {
+		if selector.matches(tags) {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
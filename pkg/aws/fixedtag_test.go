@@ -0,0 +1,245 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestParsePoolSelector(t *testing.T) {
+	t.Run("given selectors when they are parsed then they are filtered by EC2 and matched by tags", func(t *testing.T) {
+		for pool, tc := range map[string]struct {
+			filters []types.Filter
+			matches map[string]string
+			misses  map[string]string
+		}{
+			"pool": {
+				filters: []types.Filter{{Name: aws.String("tag-key"), Values: []string{"pool"}}},
+				matches: map[string]string{"pool": "any"},
+				misses:  map[string]string{"other": "any"},
+			},
+			"pool=egress,region-group in (eu,us)": {
+				filters: []types.Filter{
+					{Name: aws.String("tag:pool"), Values: []string{"egress"}},
+					{Name: aws.String("tag:region-group"), Values: []string{"eu", "us"}},
+				},
+				matches: map[string]string{"pool": "egress", "region-group": "us"},
+				misses:  map[string]string{"pool": "egress", "region-group": "ap"},
+			},
+			"pool=egress,!reserved": {
+				filters: []types.Filter{{Name: aws.String("tag:pool"), Values: []string{"egress"}}},
+				matches: map[string]string{"pool": "egress"},
+				misses:  map[string]string{"pool": "egress", "reserved": "true"},
+			},
+			"pool,region-group notin (test)": {
+				filters: []types.Filter{{Name: aws.String("tag-key"), Values: []string{"pool"}}},
+				matches: map[string]string{"pool": "egress", "region-group": "eu"},
+				misses:  map[string]string{"pool": "egress", "region-group": "test"},
+			},
+			"pool==egress,pool in (egress)": {
+				// requirements of the same key are filtered once, a second tag filter would be ANDed by EC2
+				filters: []types.Filter{{Name: aws.String("tag:pool"), Values: []string{"egress"}}},
+				matches: map[string]string{"pool": "egress"},
+				misses:  map[string]string{"pool": "ingress"},
+			},
+			"team:egress": {
+				// not a valid selector, the baseline tag key
+				filters: []types.Filter{{Name: aws.String("tag-key"), Values: []string{"team:egress"}}},
+				matches: map[string]string{"team:egress": ""},
+				misses:  map[string]string{"team": "egress"},
+			},
+			"egress pool": {
+				filters: []types.Filter{{Name: aws.String("tag-key"), Values: []string{"egress pool"}}},
+				matches: map[string]string{"egress pool": "true"},
+				misses:  map[string]string{"egress": "pool"},
+			},
+		} {
+			selector, err := parsePoolSelector(pool)
+			assert.NoError(t, err, pool)
+			assert.Equal(t, tc.filters, selector.filters(), pool)
+			assert.True(t, selector.matches(tc.matches), pool)
+			assert.False(t, selector.matches(tc.misses), pool)
+		}
+	})
+
+	t.Run("given selectors without an equality, set or existence requirement when they are parsed then they are invalid", func(t *testing.T) {
+		for _, pool := range []string{"", " ", "pool notin (test)", "!reserved", "pool!=test", "pool!=test,!reserved"} {
+			_, err := parsePoolSelector(pool)
+			assert.ErrorIs(t, err, ErrInvalidParameter, pool)
+		}
+	})
+}
+
+func TestFixedTagProvider_LockKey(t *testing.T) {
+	t.Run("given pods with overlapping selectors when they are locked then they take the same lock", func(t *testing.T) {
+		lockKey := func(pool string) string {
+			return fixedTagProvider{}.LockKey(AssociateAddressOptions{Annotations: map[string]string{pkg.PodAddressFixedTagAnnotationKey: pool}})
+		}
+
+		assert.Equal(t, lockKey("pool=egress"), lockKey("pool in (egress,ingress)"))
+	})
+}
+
+func TestHeldByController(t *testing.T) {
+	t.Run("given addresses of other modes when they are checked then they are held by the controller", func(t *testing.T) {
+		for name, tags := range map[string]map[string]string{
+			"warm pool": {pkg.TagWarmPoolKey: "amazon"},
+			"sticky":    {pkg.TagStickyKey: "statefulset/default/web-0"},
+			"workload":  {pkg.TagWorkloadKey: "Deployment/default/web"},
+			"auto":      {pkg.TagTypeKey: pkg.PodEIPAnnotationValueAuto},
+			"workload type": {
+				pkg.TagTypeKey: pkg.PodEIPAnnotationValueWorkload,
+			},
+		} {
+			assert.True(t, heldByController(address{tags: tags}), name)
+		}
+	})
+
+	t.Run("given fixed-tag pool addresses when they are checked then they are not held by the controller", func(t *testing.T) {
+		for name, tags := range map[string]map[string]string{
+			"untagged":        {"pool": "egress"},
+			"fixed-tag":       {"pool": "egress", pkg.TagTypeKey: pkg.PodEIPAnnotationValueFixedTag, pkg.TagPodKey: "default/test"},
+			"fixed-allocated": {"pool": "egress", pkg.TagTypeKey: pkg.PodEIPAnnotationValueFixedAllocation, pkg.TagPodKey: "default/test"},
+		} {
+			assert.False(t, heldByController(address{tags: tags}), name)
+		}
+	})
+}
+
+func TestInUse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		addr address
+		want bool
+	}{
+		"given unassociated address without pod tags when it is checked then it is free": {
+			addr: address{tags: map[string]string{"pool": "egress"}},
+			want: false,
+		},
+		"given associated address when it is checked then it is in use": {
+			addr: address{associationID: "eipassoc-1", tags: map[string]string{"pool": "egress"}},
+			want: true,
+		},
+		"given address tagged with a pod which is associating it when it is checked then it is in use": {
+			addr: address{tags: map[string]string{"pool": "egress", pkg.TagPodKey: "default/test"}},
+			want: true,
+		},
+		"given address with a mode tag when it is checked then it is in use": {
+			addr: address{tags: map[string]string{"pool": "egress", pkg.TagTypeKey: pkg.PodEIPAnnotationValueFixedTag}},
+			want: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, inUse(tc.addr))
+		})
+	}
+}
+
+func TestSelectAddress(t *testing.T) {
+	addrs := func() []address {
+		return []address{
+			{allocationID: "eipalloc-1", publicIP: "10.0.0.20", tags: map[string]string{pkg.TagReleasedAtKey: "2024-01-01T12:00:00Z"}},
+			{allocationID: "eipalloc-2", publicIP: "10.0.0.3", tags: map[string]string{pkg.TagReleasedAtKey: "2024-01-01T10:00:00Z"}},
+			{allocationID: "eipalloc-3", publicIP: "10.0.0.100", tags: map[string]string{pkg.TagReleasedAtKey: "2024-01-01T11:00:00Z"}},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		strategy string
+		addrs    []address
+		want     string
+	}{
+		"given no strategy when address is selected then the first one is returned": {
+			strategy: "", addrs: addrs(), want: "eipalloc-1",
+		},
+		"given first strategy when address is selected then the first one is returned": {
+			strategy: pkg.FixedTagStrategyFirst, addrs: addrs(), want: "eipalloc-1",
+		},
+		"given least recently used strategy when address is selected then the one released first is returned": {
+			strategy: pkg.FixedTagStrategyLeastRecentlyUsed, addrs: addrs(), want: "eipalloc-2",
+		},
+		"given least recently used strategy when an address was never released then it is returned": {
+			strategy: pkg.FixedTagStrategyLeastRecentlyUsed,
+			addrs:    append(addrs(), address{allocationID: "eipalloc-4", publicIP: "10.0.0.4"}),
+			want:     "eipalloc-4",
+		},
+		"given lowest IP strategy when address is selected then the numerically lowest IP is returned": {
+			strategy: pkg.FixedTagStrategyLowestIP, addrs: addrs(), want: "eipalloc-2",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			addr, err := selectAddress(tc.addrs, tc.strategy)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, addr.allocationID)
+		})
+	}
+
+	t.Run("given random strategy when address is selected then one of the addresses is returned", func(t *testing.T) {
+		addr, err := selectAddress(addrs(), pkg.FixedTagStrategyRandom)
+		assert.NoError(t, err)
+		assert.Contains(t, []string{"eipalloc-1", "eipalloc-2", "eipalloc-3"}, addr.allocationID)
+	})
+
+	t.Run("given unknown strategy when address is selected then it is invalid", func(t *testing.T) {
+		_, err := selectAddress(addrs(), "newest")
+		assert.ErrorIs(t, err, ErrInvalidParameter)
+	})
+}
+
+func TestEC2Client_getTagAddress(t *testing.T) {
+	pool := func(tags map[string]string) map[string]string {
+		tags["pool"] = "egress"
+		return tags
+	}
+	held := []testAddress{
+		{allocationID: "eipalloc-warm", publicIP: "1.1.1.1", tags: pool(map[string]string{pkg.TagWarmPoolKey: "amazon"})},
+		{allocationID: "eipalloc-auto", publicIP: "1.1.1.2", tags: pool(map[string]string{pkg.TagTypeKey: pkg.PodEIPAnnotationValueAuto})},
+		{allocationID: "eipalloc-sticky", publicIP: "1.1.1.3", tags: pool(map[string]string{pkg.TagStickyKey: "key/default/web"})},
+		{allocationID: "eipalloc-workload", publicIP: "1.1.1.7", tags: pool(map[string]string{pkg.TagWorkloadKey: "Deployment/default/web"})},
+	}
+	inUse := []testAddress{
+		{allocationID: "eipalloc-associated", publicIP: "1.1.1.4", associationID: "eipassoc-1", eniID: "eni-1", privateIP: "10.0.0.1", tags: pool(map[string]string{})},
+		{allocationID: "eipalloc-tagged", publicIP: "1.1.1.5", tags: pool(map[string]string{pkg.TagPodKey: "default/other", pkg.TagTypeKey: pkg.PodEIPAnnotationValueFixedTag})},
+	}
+
+	t.Run("given pool with controller addresses when address is taken then a free pool address is returned", func(t *testing.T) {
+		free := testAddress{allocationID: "eipalloc-free", publicIP: "1.1.1.6", tags: pool(map[string]string{})}
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(append(append(append([]testAddress{}, held...), inUse...), free)...)},
+		})
+
+		addr, err := c.getTagAddress(context.Background(), "pool=egress", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "eipalloc-free", addr.allocationID)
+	})
+
+	t.Run("given pool without free addresses when address is taken then the pool is exhausted", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(append(append([]testAddress{}, held...), inUse...)...)},
+		})
+		t.Cleanup(func() { exhausted.remove("pool=egress") })
+
+		_, err := c.getTagAddress(context.Background(), "pool=egress", "")
+		var exhaustedErr PoolExhaustedError
+		assert.True(t, errors.As(err, &exhaustedErr))
+		assert.Equal(t, PoolExhaustedError{Selector: "pool=egress", Total: 2}, exhaustedErr)
+		assert.Equal(t, []string{"pool=egress"}, exhausted.matching(map[string]string{"pool": "egress"}))
+		assert.Empty(t, exhausted.matching(map[string]string{"pool": "ingress"}))
+	})
+
+	t.Run("given negative only selector when address is taken then EC2 is not called", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, nil)
+
+		_, err := c.getTagAddress(context.Background(), "pool notin (test)", "")
+		assert.ErrorIs(t, err, ErrInvalidParameter)
+		assert.Empty(t, endpoint.called())
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func init() {
+	RegisterAddressProvider(fixedTagValueProvider{})
+}
+
+// statefulSetPodIndexLabel is the ordinal label of StatefulSet pods since Kubernetes 1.28
+const statefulSetPodIndexLabel = "apps.kubernetes.io/pod-index"
+
+// fixedTagValueProvider takes the address whose tag, named by the pod annotation, has the pod key or the value of the
+// pod template annotation and untags it on deletion
+type fixedTagValueProvider struct{}
+
+func (fixedTagValueProvider) Type() string {
+	return pkg.PodEIPAnnotationValueFixedTagValue
+}
+
+func (fixedTagValueProvider) DesiredState() []StateKey {
+	return []StateKey{
+		{Annotation: pkg.PodAddressFixedTagValueAnnotationKey, Label: pkg.PodFixedTagValueLabel},
+		{Annotation: pkg.PodAddressFixedTagValueTemplateAnnotationKey, Label: pkg.PodFixedTagValueTemplateLabel},
+	}
+}
+
+func (fixedTagValueProvider) LockKey(AssociateAddressOptions) string {
+	return ""
+}
+
+func (fixedTagValueProvider) Acquire(ctx context.Context, c EC2Client, options AssociateAddressOptions) (AcquiredAddress, error) {
+	value, err := tagValue(options)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	allocationID, publicIP, err := c.getTagValueAddress(ctx, options.Annotations[pkg.PodAddressFixedTagValueAnnotationKey], value)
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	if err := c.tagPodAddress(ctx, allocationID, options.PodKey, pkg.PodEIPAnnotationValueFixedTagValue); err != nil {
+		return AcquiredAddress{}, err
+	}
+	return AcquiredAddress{AllocationID: allocationID, PublicIP: publicIP}, nil
+}
+
+func (fixedTagValueProvider) Release(ctx context.Context, c EC2Client, addr address) ([]string, error) {
+	return nil, c.untagPodAddress(ctx, addr.allocationID)
+}
+
+// tagValueTemplateData is the data of the tag value template, e.g. game-{{.Ordinal}} or {{.OwnerName}}-{{index .Labels "zone"}}
+type tagValueTemplateData struct {
+	Namespace string
+	Name      string
+	Labels    map[string]string
+	// OwnerName is the name of the controller owner of the pod, e.g. the StatefulSet or ReplicaSet
+	OwnerName string
+	ownerKind string
+}
+
+// Ordinal returns the StatefulSet ordinal of the pod, it fails for pods of other owners
+func (d tagValueTemplateData) Ordinal() (int, error) {
+	if d.ownerKind != "StatefulSet" {
+		return 0, fmt.Errorf("pod %s/%s is not owned by a StatefulSet", d.Namespace, d.Name)
+	}
+	if index, ok := d.Labels[statefulSetPodIndexLabel]; ok {
+		return strconv.Atoi(index)
+	}
+	return strconv.Atoi(strings.TrimPrefix(d.Name, d.OwnerName+"-"))
+}
+
+// tagValue returns the tag value of the pod address, the pod key without a template
+func tagValue(options AssociateAddressOptions) (string, error) {
+	text, ok := options.Annotations[pkg.PodAddressFixedTagValueTemplateAnnotationKey]
+	if !ok {
+		return options.PodKey, nil
+	}
+	tmpl, err := template.New("tag-value").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", newError(ErrInvalidParameter, "parse tag value template %q: %v", text, err)
+	}
+	namespace, name, _ := strings.Cut(options.PodKey, "/")
+	var value strings.Builder
+	if err := tmpl.Execute(&value, tagValueTemplateData{
+		Namespace: namespace,
+		Name:      name,
+		Labels:    options.Labels,
+		OwnerName: options.OwnerName,
+		ownerKind: options.OwnerKind,
+	}); err != nil {
+		return "", newError(ErrInvalidParameter, "execute tag value template %q: %v", text, err)
+	}
+	if value.Len() == 0 {
+		return "", newError(ErrInvalidParameter, "tag value template %q is empty for pod %s", text, options.PodKey)
+	}
+	return value.String(), nil
+}
+
+func (c EC2Client) getTagValueAddress(ctx context.Context, tagKey, value string) (allocationID string, publicIP string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 describe-addresses --filters Name=tag:%,Values=demo/demo-0
+	describeResult, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		Filters: []types.Filter{
+			{Name: aws.String(fmt.Sprintf("tag:%s", tagKey)), Values: []string{value}},
+		},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("get tag-value address fail: %w", classify(err))
+	}
+	if len(describeResult.Addresses) == 0 {
+		return "", "", newError(ErrNotFound, "no address found for tag-value key %s value %s", tagKey, value)
+	}
+	return *describeResult.Addresses[0].AllocationId, *describeResult.Addresses[0].PublicIp, nil
+}
@@ -0,0 +1,72 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestTagValue(t *testing.T) {
+	options := func(template string, ownerKind, ownerName string, labels map[string]string) AssociateAddressOptions {
+		return AssociateAddressOptions{
+			PodKey:      "game/server-3",
+			Annotations: map[string]string{pkg.PodAddressFixedTagValueTemplateAnnotationKey: template},
+			Labels:      labels,
+			OwnerKind:   ownerKind,
+			OwnerName:   ownerName,
+		}
+	}
+
+	t.Run("given no template when tag value is computed then it is the pod key", func(t *testing.T) {
+		value, err := tagValue(AssociateAddressOptions{PodKey: "game/server-3"})
+		assert.NoError(t, err)
+		assert.Equal(t, "game/server-3", value)
+	})
+
+	for name, tc := range map[string]struct {
+		options AssociateAddressOptions
+		want    string
+	}{
+		"given namespace and name template when tag value is computed then it is rendered": {
+			options: options("{{.Namespace}}-{{.Name}}", "", "", nil),
+			want:    "game-server-3",
+		},
+		"given label template when tag value is computed then the label is rendered": {
+			options: options(`{{.OwnerName}}-{{index .Labels "zone"}}`, "ReplicaSet", "server-5d8f", map[string]string{"zone": "eu"}),
+			want:    "server-5d8f-eu",
+		},
+		"given ordinal template when pod of a StatefulSet has the pod index label then it is the ordinal": {
+			options: options("server-{{.Ordinal}}", "StatefulSet", "server", map[string]string{"apps.kubernetes.io/pod-index": "7"}),
+			want:    "server-7",
+		},
+		"given ordinal template when pod of a StatefulSet has no pod index label then it is the name suffix": {
+			options: options("server-{{.Ordinal}}", "StatefulSet", "server", nil),
+			want:    "server-3",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			value, err := tagValue(tc.options)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, value)
+		})
+	}
+
+	for name, tc := range map[string]AssociateAddressOptions{
+		"given invalid template when tag value is computed then it is invalid":                  options("{{.Name", "", "", nil),
+		"given ordinal template when pod is not owned by a StatefulSet then it is invalid":      options("server-{{.Ordinal}}", "ReplicaSet", "server-5d8f", nil),
+		"given ordinal template when the name has no ordinal suffix then it is invalid":         options("server-{{.Ordinal}}", "StatefulSet", "other", nil),
+		"given missing label field when tag value is computed then it is invalid":               options("{{.Labels.zone}}", "", "", map[string]string{}),
+		"given unknown field when tag value is computed then it is invalid":                     options("{{.Node}}", "", "", nil),
+		"given template rendering an empty value when tag value is computed then it is invalid": options(`{{index .Labels "zone"}}`, "", "", nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := tagValue(tc)
+			assert.ErrorIs(t, err, ErrInvalidParameter)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+// AddressProvider acquires and releases the addresses of one PEC mode, a mode is added by registering its provider
+// with RegisterAddressProvider from init
+type AddressProvider interface {
+	// Type is the PEC type annotation value of the mode
+	Type() string
+	// DesiredState are the pod annotations the address is acquired for, the pod is processed again when one of them changes
+	DesiredState() []StateKey
+	// LockKey returns the key locked from acquiring the address until it is associated, empty for no lock
+	LockKey(options AssociateAddressOptions) string
+	// Acquire returns an unassociated address tagged with the pod
+	Acquire(ctx context.Context, c EC2Client, options AssociateAddressOptions) (AcquiredAddress, error)
+	// Release returns the disassociated address of a pod, e.g. releases it or deletes its pod tags, and returns the
+	// fixed-tag pools the address went back to
+	Release(ctx context.Context, c EC2Client, addr address) (pools []string, err error)
+}
+
+// StateKey is a pod annotation an address depends on and the pod label which records its value once the address is associated
+type StateKey struct {
+	Annotation string
+	Label      string
+}
+
+type AcquiredAddress struct {
+	AllocationID string
+	PublicIP     string
+	// Labels are added to the pod besides the desired state labels, e.g. details of the acquired address
+	Labels map[string]string
+}
+
+var addressProviders = make(map[string]AddressProvider)
+
+// RegisterAddressProvider makes the mode of the provider available, it is not safe to call after init
+func RegisterAddressProvider(provider AddressProvider) {
+	addressProviders[provider.Type()] = provider
+}
+
+func GetAddressProvider(pecType string) (AddressProvider, bool) {
+	provider, ok := addressProviders[pecType]
+	return provider, ok
+}
+
+// ValidPECType returns whether a provider is registered for the PEC type
+func ValidPECType(pecType string) bool {
+	_, ok := addressProviders[pecType]
+	return ok
+}
+
+// returnAddress returns a disassociated address with the provider of its mode, addresses without a known mode are left as they are
+func (c EC2Client) returnAddress(ctx context.Context, addr address) (pools []string, err error) {
+	provider, ok := GetAddressProvider(addr.tags[pkg.TagTypeKey])
+	if !ok {
+		return nil, nil
+	}
+	return provider.Release(ctx, c, addr)
+}
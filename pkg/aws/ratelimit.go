@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+// RateLimit is the client-side token bucket of an EC2 action category, QPS 0 disables the limit
+type RateLimit struct {
+	QPS   float32
+	Burst int
+}
+
+func (r RateLimit) limiter() flowcontrol.RateLimiter {
+	if r.QPS <= 0 {
+		return flowcontrol.NewFakeAlwaysRateLimiter()
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(r.QPS, r.Burst)
+}
+
+// rateLimiter waits for a token of the EC2 action category before every call and counts throttled attempts
+type rateLimiter struct {
+	logger    *slog.Logger
+	describe  flowcontrol.RateLimiter
+	mutate    flowcontrol.RateLimiter
+	throttled *atomic.Int64
+}
+
+func newRateLimiter(logger *slog.Logger, describe, mutate RateLimit) rateLimiter {
+	return rateLimiter{
+		logger:    logger,
+		describe:  describe.limiter(),
+		mutate:    mutate.limiter(),
+		throttled: new(atomic.Int64),
+	}
+}
+
+// addMiddleware adds the rate limiter to the EC2 client API operations
+func (r rateLimiter) addMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("PECRateLimit", r.handleInitialize), middleware.Before)
+}
+
+func (r rateLimiter) handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+	middleware.InitializeOutput, middleware.Metadata, error,
+) {
+	operation := middleware.GetOperationName(ctx)
+	limiter := r.mutate
+	if strings.HasPrefix(operation, "Describe") {
+		limiter = r.describe
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("wait for %s rate limit: %w", operation, err)
+	}
+
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if throttled := throttledAttempts(metadata); throttled > 0 {
+		total := r.throttled.Add(throttled)
+		pkg.AddMetric("ec2_throttled_attempts", throttled)
+		r.logger.Warn(fmt.Sprintf("%s throttled %d times, %d throttled attempts in total", operation, throttled, total))
+		if err != nil {
+			err = fmt.Errorf("%w, throttled %d times", err, throttled)
+		}
+	}
+	return out, metadata, err
+}
+
+// throttledAttempts returns the number of attempts of the call which failed because of throttling
+func throttledAttempts(metadata middleware.Metadata) int64 {
+	results, ok := retry.GetAttemptResults(metadata)
+	if !ok {
+		return 0
+	}
+	var throttled int64
+	for _, result := range results.Results {
+		var classified *Error
+		if errors.As(classify(result.Err), &classified) && classified.Throttled() {
+			throttled++
+		}
+	}
+	return throttled
+}
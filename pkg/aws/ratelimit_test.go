@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit_limiter(t *testing.T) {
+	t.Run("given no QPS when calls are made then they are not limited", func(t *testing.T) {
+		limiter := RateLimit{}.limiter()
+		for range 100 {
+			assert.True(t, limiter.TryAccept())
+		}
+	})
+
+	t.Run("given QPS and burst when calls exceed the burst then they are limited", func(t *testing.T) {
+		limiter := RateLimit{QPS: 0.001, Burst: 2}.limiter()
+		assert.True(t, limiter.TryAccept())
+		assert.True(t, limiter.TryAccept())
+		assert.False(t, limiter.TryAccept())
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	withRetries := func(limiter rateLimiter) func(*ec2.Options) {
+		return func(o *ec2.Options) {
+			o.RetryMaxAttempts = 0
+			o.Retryer = retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = 3
+				o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+				// throttled attempts would run out the retry token bucket
+				o.RateLimiter = ratelimit.None
+			})
+			o.APIOptions = append(o.APIOptions, limiter.addMiddleware)
+		}
+	}
+
+	t.Run("given throttled attempts when the call succeeds then the throttled attempts are counted", func(t *testing.T) {
+		limiter := newRateLimiter(noOpLogger, RateLimit{}, RateLimit{})
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {
+				testEC2Error("RequestLimitExceeded", "throttled"),
+				testEC2Error("RequestLimitExceeded", "throttled"),
+				testDescribeAddresses(),
+			},
+		}, withRetries(limiter))
+
+		_, err := c.client.DescribeAddresses(context.Background(), &ec2.DescribeAddressesInput{})
+		assert.NoError(t, err)
+		assert.Len(t, endpoint.called(), 3)
+		assert.Equal(t, int64(2), limiter.throttled.Load())
+	})
+
+	t.Run("given failed attempts which are not throttled when the call fails then no attempts are counted", func(t *testing.T) {
+		limiter := newRateLimiter(noOpLogger, RateLimit{}, RateLimit{})
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testEC2Error("InvalidParameterValue", "invalid")},
+		}, withRetries(limiter))
+
+		_, err := c.client.DescribeAddresses(context.Background(), &ec2.DescribeAddressesInput{})
+		assert.Error(t, err)
+		assert.Equal(t, int64(0), limiter.throttled.Load())
+	})
+
+	t.Run("given exhausted describe limit when a describe call is made then it waits for the context", func(t *testing.T) {
+		limiter := newRateLimiter(noOpLogger, RateLimit{QPS: 0.001, Burst: 1}, RateLimit{})
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses":   {testDescribeAddresses()},
+			"DisassociateAddress": {testEC2Response("DisassociateAddress")},
+		}, withRetries(limiter))
+
+		_, err := c.client.DescribeAddresses(context.Background(), &ec2.DescribeAddressesInput{})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{})
+		assert.Error(t, err)
+
+		// mutating calls have their own limit
+		_, err = c.client.DisassociateAddress(context.Background(), &ec2.DisassociateAddressInput{AssociationId: aws.String("eipassoc-1")})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"DescribeAddresses", "DisassociateAddress"}, endpoint.called())
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+// stickyIdentity returns the identity an auto mode address of the pod is parked for, the sticky key annotation in the
+// namespace of the pod or the name of a StatefulSet pod, which includes its ordinal. It is empty for other pods.
+func stickyIdentity(options AssociateAddressOptions) string {
+	if key := options.Annotations[pkg.PodAddressStickyKeyAnnotationKey]; key != "" {
+		namespace, _, _ := strings.Cut(options.PodKey, "/")
+		return fmt.Sprintf("key/%s/%s", namespace, key)
+	}
+	if options.OwnerKind == "StatefulSet" {
+		return "statefulset/" + options.PodKey
+	}
+	return ""
+}
+
+// stickyLockKey is the key lock of the addresses parked for an identity
+func stickyLockKey(identity string) string {
+	return "sticky/" + identity
+}
+
+// parkAddress records when a disassociated address was parked and untags the pod, the parked time is created first
+// so a sticky address without a pod always has one. The sticky lock of the identity must not be held.
+func (c EC2Client) parkAddress(ctx context.Context, addr address, identity string) error {
+	key := stickyLockKey(identity)
+	keyLocks.Lock(key)
+	defer keyLocks.Unlock(key)
+
+	if err := c.createTag(ctx, addr.allocationID, map[string]string{
+		pkg.TagParkedSinceKey: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+	if err := c.deleteTag(ctx, addr.allocationID, []string{pkg.TagPodKey}); err != nil {
+		return err
+	}
+	c.logger.Info(fmt.Sprintf("parked address %s (allocation-id %s) for %s for %s", addr.publicIP, addr.allocationID, identity, c.stickyRetainPeriod))
+	return nil
+}
+
+// takeParkedAddress tags an address parked for the identity with the pod, ok is false if there is none. The sticky
+// lock of the identity has to be held.
+func (c EC2Client) takeParkedAddress(ctx context.Context, podKey, identity string) (acquired AcquiredAddress, ok bool, err error) {
+	addrs, err := c.describeParkedAddresses(ctx, identity)
+	if err != nil {
+		return AcquiredAddress{}, false, err
+	}
+	if len(addrs) == 0 {
+		return AcquiredAddress{}, false, nil
+	}
+	addr := addrs[0]
+	if err := c.createTag(ctx, addr.allocationID, map[string]string{
+		pkg.TagPodKey: podKey,
+	}); err != nil {
+		return AcquiredAddress{}, false, err
+	}
+	if err := c.deleteTag(ctx, addr.allocationID, []string{pkg.TagParkedSinceKey}); err != nil {
+		return AcquiredAddress{}, false, err
+	}
+	c.logger.Info(fmt.Sprintf("took address %s (allocation-id %s) parked for %s for %s pod", addr.publicIP, addr.allocationID, identity, podKey))
+	return AcquiredAddress{AllocationID: addr.allocationID, PublicIP: addr.publicIP}, true, nil
+}
+
+// MaintainParkedAddresses releases the parked addresses whose retain period has expired, addresses without a valid
+// parked time are kept as they may be taken by a pod in the meantime
+func (c EC2Client) MaintainParkedAddresses(ctx context.Context) {
+	addrs, err := c.describeParkedAddresses(ctx, "")
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("maintain parked addresses: %v", err))
+		return
+	}
+	for _, addr := range addrs {
+		since, err := time.Parse(time.RFC3339, addr.tags[pkg.TagParkedSinceKey])
+		if err != nil {
+			c.logger.Warn(fmt.Sprintf("parked address %s (allocation-id %s) of %s has no valid parked time %q, keeping it", addr.publicIP, addr.allocationID, addr.tags[pkg.TagStickyKey], addr.tags[pkg.TagParkedSinceKey]))
+			continue
+		}
+		if time.Since(since) < c.stickyRetainPeriod {
+			continue
+		}
+		if err := c.releaseParkedAddress(ctx, addr); err != nil {
+			c.logger.Error(fmt.Sprintf("release parked address %s (allocation-id %s): %v", addr.publicIP, addr.allocationID, err))
+			continue
+		}
+		c.logger.Info(fmt.Sprintf("released address %s (allocation-id %s) parked for %s since %s", addr.publicIP, addr.allocationID, addr.tags[pkg.TagStickyKey], since))
+	}
+}
+
+// releaseParkedAddress releases a parked address unless a pod has taken it in the meantime
+func (c EC2Client) releaseParkedAddress(ctx context.Context, addr address) error {
+	key := stickyLockKey(addr.tags[pkg.TagStickyKey])
+	keyLocks.Lock(key)
+	defer keyLocks.Unlock(key)
+
+	current, err := c.describeAllocation(ctx, addr.allocationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := current.tags[pkg.TagPodKey]; ok || current.associationID != "" {
+		return nil
+	}
+	return c.releaseAddress(ctx, addr.allocationID)
+}
+
+// describeParkedAddresses returns the unassociated addresses of the cluster parked for the identity, for all
+// identities if it is empty. Parked addresses are the sticky addresses without a pod.
+func (c EC2Client) describeParkedAddresses(ctx context.Context, identity string) ([]address, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	filters := []types.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", pkg.TagClusterNameKey)),
+			Values: []string{c.clusterName},
+		},
+	}
+	if identity != "" {
+		filters = append(filters,
+			types.Filter{Name: aws.String(fmt.Sprintf("tag:%s", pkg.TagStickyKey)), Values: []string{identity}},
+			types.Filter{Name: aws.String("tag-key"), Values: []string{pkg.TagParkedSinceKey}},
+		)
+	} else {
+		filters = append(filters, types.Filter{Name: aws.String("tag-key"), Values: []string{pkg.TagStickyKey}})
+	}
+	result, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{Filters: filters})
+	if err != nil {
+		return nil, fmt.Errorf("describe parked address %q: %w", identity, classify(err))
+	}
+	var out []address
+	for _, v := range result.Addresses {
+		addr := toAddress(v)
+		if _, ok := addr.tags[pkg.TagPodKey]; ok || addr.associationID != "" {
+			continue
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
@@ -0,0 +1,168 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestStickyIdentity(t *testing.T) {
+	for name, tc := range map[string]struct {
+		options AssociateAddressOptions
+		want    string
+	}{
+		"given pod with sticky key when the identity is computed then it is the key in the namespace": {
+			options: AssociateAddressOptions{PodKey: "game/server-5d8f", Annotations: map[string]string{pkg.PodAddressStickyKeyAnnotationKey: "lobby"}, OwnerKind: "ReplicaSet"},
+			want:    "key/game/lobby",
+		},
+		"given StatefulSet pod when the identity is computed then it is the pod": {
+			options: AssociateAddressOptions{PodKey: "game/server-3", OwnerKind: "StatefulSet"},
+			want:    "statefulset/game/server-3",
+		},
+		"given StatefulSet pod with sticky key when the identity is computed then it is the key": {
+			options: AssociateAddressOptions{PodKey: "game/server-3", Annotations: map[string]string{pkg.PodAddressStickyKeyAnnotationKey: "lobby"}, OwnerKind: "StatefulSet"},
+			want:    "key/game/lobby",
+		},
+		"given pod of another owner when the identity is computed then it is empty": {
+			options: AssociateAddressOptions{PodKey: "game/server-5d8f", OwnerKind: "ReplicaSet"},
+			want:    "",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, stickyIdentity(tc.options))
+		})
+	}
+}
+
+func TestAutoProvider_Acquire_sticky(t *testing.T) {
+	options := AssociateAddressOptions{PodKey: "game/server-3", PECType: pkg.PodEIPAnnotationValueAuto, OwnerKind: "StatefulSet"}
+
+	t.Run("given StatefulSet pod without parked address when address is acquired then it is allocated with the sticky tag", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses()},
+			"AllocateAddress":   {testAllocateAddress("eipalloc-1", "1.1.1.1")},
+		})
+		c.stickyRetainPeriod = time.Hour
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, options)
+		assert.NoError(t, err)
+		assert.Equal(t, "eipalloc-1", acquired.AllocationID)
+		requests := endpoint.requested("AllocateAddress")
+		assert.Len(t, requests, 1)
+		tags := testAllocatedTags(requests[0])
+		assert.Equal(t, "statefulset/game/server-3", tags[pkg.TagStickyKey])
+		assert.Equal(t, "game/server-3", tags[pkg.TagPodKey])
+	})
+
+	t.Run("given StatefulSet pod with parked address when address is acquired then the parked address is taken", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(testAddress{allocationID: "eipalloc-parked", publicIP: "1.1.1.2", tags: map[string]string{
+				pkg.TagStickyKey:      "statefulset/game/server-3",
+				pkg.TagParkedSinceKey: "2024-01-01T10:00:00Z",
+			}})},
+			"CreateTags": {testEC2Response("CreateTags")},
+			"DeleteTags": {testEC2Response("DeleteTags")},
+		})
+		c.stickyRetainPeriod = time.Hour
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, options)
+		assert.NoError(t, err)
+		assert.Equal(t, "eipalloc-parked", acquired.AllocationID)
+		assert.Equal(t, []string{"DescribeAddresses", "CreateTags", "DeleteTags"}, endpoint.called())
+	})
+
+	t.Run("given sticky addresses disabled when address is acquired then it is allocated without the sticky tag", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testAllocateAddress("eipalloc-1", "1.1.1.1")},
+		})
+
+		_, err := autoProvider{}.Acquire(context.Background(), c, options)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"AllocateAddress"}, endpoint.called())
+		assert.NotContains(t, testAllocatedTags(endpoint.requested("AllocateAddress")[0]), pkg.TagStickyKey)
+	})
+}
+
+func TestEC2Client_parkAddress(t *testing.T) {
+	t.Run("given sticky address when it is parked then the parked time is created before the pod tag is deleted", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"CreateTags": {testEC2Response("CreateTags")},
+			"DeleteTags": {testEC2Response("DeleteTags")},
+		})
+
+		err := c.parkAddress(context.Background(), address{allocationID: "eipalloc-1", publicIP: "1.1.1.1"}, "statefulset/game/server-3")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"CreateTags", "DeleteTags"}, endpoint.called())
+		assert.Equal(t, pkg.TagParkedSinceKey, endpoint.requested("CreateTags")[0].Get("Tag.1.Key"))
+		assert.Equal(t, pkg.TagPodKey, endpoint.requested("DeleteTags")[0].Get("Tag.1.Key"))
+	})
+
+	t.Run("given parked time can not be created when address is parked then the pod tag is kept", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"CreateTags": {testEC2Error("RequestLimitExceeded", "throttled")},
+		})
+
+		err := c.parkAddress(context.Background(), address{allocationID: "eipalloc-1", publicIP: "1.1.1.1"}, "statefulset/game/server-3")
+		assert.ErrorIs(t, err, ErrThrottled)
+		assert.Equal(t, []string{"CreateTags"}, endpoint.called())
+	})
+}
+
+func TestEC2Client_MaintainParkedAddresses(t *testing.T) {
+	t.Run("given parked addresses when they are maintained then only the expired ones are released", func(t *testing.T) {
+		expired := testAddress{allocationID: "eipalloc-expired", publicIP: "1.1.1.1", tags: map[string]string{
+			pkg.TagStickyKey:      "statefulset/game/server-1",
+			pkg.TagParkedSinceKey: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+		}}
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {
+				testDescribeAddresses(
+					expired,
+					testAddress{allocationID: "eipalloc-recent", publicIP: "1.1.1.2", tags: map[string]string{
+						pkg.TagStickyKey:      "statefulset/game/server-2",
+						pkg.TagParkedSinceKey: time.Now().UTC().Format(time.RFC3339),
+					}},
+					// a pod is still parking it, or the parked time was mangled
+					testAddress{allocationID: "eipalloc-unparked", publicIP: "1.1.1.3", tags: map[string]string{
+						pkg.TagStickyKey: "statefulset/game/server-3",
+					}},
+					testAddress{allocationID: "eipalloc-invalid", publicIP: "1.1.1.4", tags: map[string]string{
+						pkg.TagStickyKey:      "statefulset/game/server-4",
+						pkg.TagParkedSinceKey: "yesterday",
+					}},
+				),
+				testDescribeAddresses(expired),
+			},
+			"ReleaseAddress": {testEC2Response("ReleaseAddress")},
+		})
+		c.stickyRetainPeriod = time.Hour
+
+		c.MaintainParkedAddresses(context.Background())
+		releases := endpoint.requested("ReleaseAddress")
+		assert.Len(t, releases, 1)
+		assert.Equal(t, "eipalloc-expired", releases[0].Get("AllocationId"))
+	})
+
+	t.Run("given expired address when a pod has taken it in the meantime then it is not released", func(t *testing.T) {
+		expired := testAddress{allocationID: "eipalloc-expired", publicIP: "1.1.1.1", tags: map[string]string{
+			pkg.TagStickyKey:      "statefulset/game/server-1",
+			pkg.TagParkedSinceKey: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+		}}
+		taken := expired
+		taken.tags = map[string]string{pkg.TagStickyKey: "statefulset/game/server-1", pkg.TagPodKey: "game/server-1"}
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses(expired), testDescribeAddresses(taken)},
+		})
+		c.stickyRetainPeriod = time.Hour
+
+		c.MaintainParkedAddresses(context.Background())
+		assert.Empty(t, endpoint.requested("ReleaseAddress"))
+	})
+}
@@ -0,0 +1,222 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+// WarmPoolConfig are the warm pools of allocated auto mode addresses which are not associated to any pod
+type WarmPoolConfig struct {
+	// Pools are the public IPv4 pool IDs with a warm pool, amazon for the Amazon pool, empty disables warm pools
+	Pools []string
+	// MinSize addresses are kept in each warm pool, up to MaxSize disassociated addresses are returned to it
+	MinSize int
+	MaxSize int
+	// TTL is how long addresses above MinSize are kept in a warm pool before they are released
+	TTL time.Duration
+}
+
+func (w WarmPoolConfig) enabled(pool string) bool {
+	return w.MaxSize > 0 && slices.Contains(w.Pools, pool)
+}
+
+type warmAddress struct {
+	allocationID string
+	publicIP     string
+	since        time.Time
+}
+
+// warmPoolLockKey is the key lock of a warm pool, so an address is taken by one pod only and sizes are not exceeded
+func warmPoolLockKey(pool string) string {
+	return "warm-pool/" + pool
+}
+
+// takeWarmAddress tags an address of the warm pool with the pod and the sticky identity unless it is empty, ok is false
+// if the pool is not enabled or empty
+func (c EC2Client) takeWarmAddress(ctx context.Context, podKey, identity, pool string) (allocationID string, publicIP string, ok bool, err error) {
+	if !c.warmPool.enabled(pool) {
+		return "", "", false, nil
+	}
+	keyLocks.Lock(warmPoolLockKey(pool))
+	defer keyLocks.Unlock(warmPoolLockKey(pool))
+
+	addrs, err := c.describeWarmAddresses(ctx, pool)
+	if err != nil {
+		return "", "", false, err
+	}
+	if len(addrs) == 0 {
+		c.logger.Info(fmt.Sprintf("warm pool %s is empty, allocating address for %s pod", pool, podKey))
+		return "", "", false, nil
+	}
+	// the most recently returned address, the oldest ones are released first
+	addr := addrs[len(addrs)-1]
+	tags := map[string]string{pkg.TagPodKey: podKey}
+	if identity != "" {
+		tags[pkg.TagStickyKey] = identity
+	}
+	if err := c.createTag(ctx, addr.allocationID, tags); err != nil {
+		return "", "", false, err
+	}
+	if err := c.deleteTag(ctx, addr.allocationID, []string{pkg.TagWarmPoolKey, pkg.TagWarmSinceKey}); err != nil {
+		return "", "", false, err
+	}
+	c.logger.Info(fmt.Sprintf("took address %s (allocation-id %s) from warm pool %s for %s pod, %d left", addr.publicIP, addr.allocationID, pool, podKey, len(addrs)-1))
+	return addr.allocationID, addr.publicIP, true, nil
+}
+
+// returnWarmAddress untags the pod from an unassociated auto mode address and returns it to the warm pool, ok is false if
+// the pool is not enabled or full and the address has to be released
+func (c EC2Client) returnWarmAddress(ctx context.Context, allocationID, pool string) (ok bool, err error) {
+	if !c.warmPool.enabled(pool) {
+		return false, nil
+	}
+	keyLocks.Lock(warmPoolLockKey(pool))
+	defer keyLocks.Unlock(warmPoolLockKey(pool))
+
+	addrs, err := c.describeWarmAddresses(ctx, pool)
+	if err != nil {
+		return false, err
+	}
+	if len(addrs) >= c.warmPool.MaxSize {
+		return false, nil
+	}
+	if err := c.createTag(ctx, allocationID, map[string]string{
+		pkg.TagWarmPoolKey:  pool,
+		pkg.TagWarmSinceKey: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return false, err
+	}
+	if err := c.deleteTag(ctx, allocationID, []string{pkg.TagPodKey}); err != nil {
+		// the address is still tagged with the pod, so it is returned again on retry and not taken from the pool
+		if undoErr := c.deleteTag(ctx, allocationID, []string{pkg.TagWarmPoolKey, pkg.TagWarmSinceKey}); undoErr != nil {
+			return false, fmt.Errorf("%w, undo warm pool %s tags: %w", err, pool, undoErr)
+		}
+		return false, err
+	}
+	c.logger.Info(fmt.Sprintf("returned allocation-id %s to warm pool %s, %d addresses", allocationID, pool, len(addrs)+1))
+	return true, nil
+}
+
+// MaintainWarmPools allocates addresses for warm pools below the minimum size and releases addresses above the minimum
+// size which have been in the pool longer than the TTL
+func (c EC2Client) MaintainWarmPools(ctx context.Context) {
+	for _, pool := range c.warmPool.Pools {
+		if err := c.maintainWarmPool(ctx, pool); err != nil {
+			c.logger.Error(fmt.Sprintf("maintain warm pool %s: %v", pool, err))
+		}
+	}
+}
+
+func (c EC2Client) maintainWarmPool(ctx context.Context, pool string) error {
+	keyLocks.Lock(warmPoolLockKey(pool))
+	defer keyLocks.Unlock(warmPoolLockKey(pool))
+
+	addrs, err := c.describeWarmAddresses(ctx, pool)
+	if err != nil {
+		return err
+	}
+	for i := len(addrs); i < c.warmPool.MinSize; i++ {
+		allocationID, publicIP, err := c.allocateWarmAddress(ctx, pool)
+		if err != nil {
+			return err
+		}
+		c.logger.Info(fmt.Sprintf("allocated address %s (allocation-id %s) for warm pool %s", publicIP, allocationID, pool))
+	}
+	for _, addr := range expiredWarmAddresses(addrs, c.warmPool.MinSize, c.warmPool.TTL, time.Now()) {
+		if err := c.releaseAddress(ctx, addr.allocationID); err != nil {
+			return err
+		}
+		c.logger.Info(fmt.Sprintf("released address %s (allocation-id %s) from warm pool %s, in the pool since %s", addr.publicIP, addr.allocationID, pool, addr.since))
+	}
+	return nil
+}
+
+// expiredWarmAddresses returns the addresses above the minimum size which have been in the pool longer than the TTL,
+// addresses have to be sorted by the time they were returned to the pool
+func expiredWarmAddresses(addrs []warmAddress, minSize int, ttl time.Duration, now time.Time) []warmAddress {
+	var expired []warmAddress
+	for _, addr := range addrs {
+		if len(addrs)-len(expired) <= minSize || now.Sub(addr.since) < ttl {
+			break
+		}
+		expired = append(expired, addr)
+	}
+	return expired
+}
+
+// describeWarmAddresses returns the unassociated addresses of the warm pool, the oldest first
+func (c EC2Client) describeWarmAddresses(ctx context.Context, pool string) ([]warmAddress, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	result, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String(fmt.Sprintf("tag:%s", pkg.TagWarmPoolKey)),
+				Values: []string{pool},
+			},
+			{
+				Name:   aws.String(fmt.Sprintf("tag:%s", pkg.TagClusterNameKey)),
+				Values: []string{c.clusterName},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe address warm pool %s: %w", pool, classify(err))
+	}
+	var out []warmAddress
+	for _, v := range result.Addresses {
+		addr := toAddress(v)
+		if addr.associationID != "" {
+			continue
+		}
+		// addresses without a valid time are the oldest
+		since, _ := time.Parse(time.RFC3339, addr.tags[pkg.TagWarmSinceKey])
+		out = append(out, warmAddress{
+			allocationID: addr.allocationID,
+			publicIP:     addr.publicIP,
+			since:        since,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].since.Before(out[j].since)
+	})
+	return out, nil
+}
+
+func (c EC2Client) allocateWarmAddress(ctx context.Context, pool string) (allocationID string, publicIP string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	input := &ec2.AllocateAddressInput{
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeElasticIp,
+				Tags: []types.Tag{
+					{Key: aws.String(pkg.TagTypeKey), Value: aws.String(pkg.PodEIPAnnotationValueAuto)},
+					{Key: aws.String(pkg.TagClusterNameKey), Value: aws.String(c.clusterName)},
+					{Key: aws.String(pkg.TagWarmPoolKey), Value: aws.String(pool)},
+					{Key: aws.String(pkg.TagWarmSinceKey), Value: aws.String(time.Now().UTC().Format(time.RFC3339))},
+				},
+			},
+		},
+	}
+	setAddressPool(input, pool)
+	allocatedResult, err := c.client.AllocateAddress(ctx, input)
+	if err != nil {
+		return "", "", fmt.Errorf("allocate warm pool %s address: %w", pool, classify(err))
+	}
+	return aws.ToString(allocatedResult.AllocationId), aws.ToString(allocatedResult.PublicIp), nil
+}
@@ -0,0 +1,98 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestExpiredWarmAddresses(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	warm := func(ids ...string) []warmAddress {
+		// the first address was returned to the pool first, every address one minute after the previous one
+		var addrs []warmAddress
+		for i, id := range ids {
+			addrs = append(addrs, warmAddress{allocationID: id, since: now.Add(time.Duration(i-len(ids)) * time.Minute)})
+		}
+		return addrs
+	}
+	allocationIDs := func(addrs []warmAddress) []string {
+		var ids []string
+		for _, addr := range addrs {
+			ids = append(ids, addr.allocationID)
+		}
+		return ids
+	}
+
+	for name, tc := range map[string]struct {
+		addrs   []warmAddress
+		minSize int
+		ttl     time.Duration
+		want    []string
+	}{
+		"given empty pool when addresses expire then none are returned": {
+			addrs: nil, minSize: 0, ttl: time.Minute, want: nil,
+		},
+		"given addresses older than the ttl when the pool has no minimum then all are returned": {
+			addrs: warm("a", "b", "c"), minSize: 0, ttl: time.Minute, want: []string{"a", "b", "c"},
+		},
+		"given addresses older than the ttl when the pool has a minimum then the minimum is kept": {
+			addrs: warm("a", "b", "c"), minSize: 2, ttl: time.Minute, want: []string{"a"},
+		},
+		"given addresses younger than the ttl when addresses expire then only the older ones are returned": {
+			addrs: warm("a", "b", "c"), minSize: 0, ttl: 2 * time.Minute, want: []string{"a", "b"},
+		},
+		"given pool at its minimum when addresses expire then none are returned": {
+			addrs: warm("a", "b"), minSize: 2, ttl: time.Minute, want: nil,
+		},
+		"given pool below its minimum when addresses expire then none are returned": {
+			addrs: warm("a"), minSize: 2, ttl: 0, want: nil,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, allocationIDs(expiredWarmAddresses(tc.addrs, tc.minSize, tc.ttl, now)))
+		})
+	}
+}
+
+func TestEC2Client_returnWarmAddress(t *testing.T) {
+	t.Run("given warm pool with room when address is returned then it is tagged with the pool and untagged from the pod", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses()},
+			"CreateTags":        {testEC2Response("CreateTags")},
+			"DeleteTags":        {testEC2Response("DeleteTags")},
+		})
+		c.warmPool = WarmPoolConfig{Pools: []string{"amazon"}, MaxSize: 1}
+
+		ok, err := c.returnWarmAddress(context.Background(), "eipalloc-1", "amazon")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []string{"DescribeAddresses", "CreateTags", "DeleteTags"}, endpoint.called())
+	})
+
+	t.Run("given pod tag which can not be deleted when address is returned then the warm pool tags are deleted again", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAddresses": {testDescribeAddresses()},
+			"CreateTags":        {testEC2Response("CreateTags")},
+			"DeleteTags":        {testEC2Error("UnauthorizedOperation", "not authorized"), testEC2Response("DeleteTags")},
+		})
+		c.warmPool = WarmPoolConfig{Pools: []string{"amazon"}, MaxSize: 1}
+
+		ok, err := c.returnWarmAddress(context.Background(), "eipalloc-1", "amazon")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.False(t, ok)
+		deleted := endpoint.requested("DeleteTags")
+		if assert.Len(t, deleted, 2) {
+			assert.Equal(t, pkg.TagPodKey, deleted[0].Get("Tag.1.Key"))
+			assert.Equal(t, pkg.TagWarmPoolKey, deleted[1].Get("Tag.1.Key"))
+			assert.Equal(t, pkg.TagWarmSinceKey, deleted[1].Get("Tag.2.Key"))
+		}
+	})
+}
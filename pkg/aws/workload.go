@@ -0,0 +1,254 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+// deploymentPodTemplateHashLabel is the label of Deployment pods which is the suffix of their ReplicaSet name
+const deploymentPodTemplateHashLabel = "pod-template-hash"
+
+func init() {
+	RegisterAddressProvider(workloadProvider{})
+}
+
+// Workload is the Deployment or StatefulSet owning a workload pool
+type Workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// String is the workload tag value of the addresses of the pool
+func (w Workload) String() string {
+	return fmt.Sprintf("%s/%s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// parseWorkload parses the workload tag value of an address
+func parseWorkload(s string) (Workload, bool) {
+	parts := strings.SplitN(s, "/", 3)
+	if len(parts) != 3 {
+		return Workload{}, false
+	}
+	return Workload{Kind: parts[0], Namespace: parts[1], Name: parts[2]}, true
+}
+
+// workloadOf returns the workload of the pod, the StatefulSet or the Deployment of the ReplicaSet owning it
+func workloadOf(options AssociateAddressOptions) (Workload, bool) {
+	namespace, _, _ := strings.Cut(options.PodKey, "/")
+	switch options.OwnerKind {
+	case "StatefulSet":
+		return Workload{Kind: "StatefulSet", Namespace: namespace, Name: options.OwnerName}, true
+	case "ReplicaSet":
+		hash := options.Labels[deploymentPodTemplateHashLabel]
+		if name, ok := strings.CutSuffix(options.OwnerName, "-"+hash); ok && hash != "" {
+			return Workload{Kind: "Deployment", Namespace: namespace, Name: name}, true
+		}
+	}
+	return Workload{}, false
+}
+
+// workloadProvider takes an unassociated address of the pool of the workload owning the pod and allocates addresses
+// for the pool up to its size, the addresses stay in the pool on pod deletion until the workload is scaled down or deleted
+type workloadProvider struct{}
+
+func (workloadProvider) Type() string {
+	return pkg.PodEIPAnnotationValueWorkload
+}
+
+func (workloadProvider) DesiredState() []StateKey {
+	return []StateKey{
+		{Annotation: pkg.PodAddressWorkloadPoolSizeAnnotationKey, Label: pkg.PodWorkloadPoolSizeLabel},
+		{Annotation: pkg.PodAddressPoolAnnotationKey, Label: pkg.PodAddressPoolIDLabel},
+	}
+}
+
+// LockKey is the workload, so the same address is not taken by multiple pods and the pool size is not exceeded
+func (workloadProvider) LockKey(options AssociateAddressOptions) string {
+	if w, ok := workloadOf(options); ok {
+		return workloadLockKey(w)
+	}
+	return ""
+}
+
+func workloadLockKey(w Workload) string {
+	return "workload/" + w.String()
+}
+
+func (workloadProvider) Acquire(ctx context.Context, c EC2Client, options AssociateAddressOptions) (AcquiredAddress, error) {
+	w, ok := workloadOf(options)
+	if !ok {
+		return AcquiredAddress{}, newError(ErrInvalidParameter, "pod %s is not owned by a Deployment or StatefulSet", options.PodKey)
+	}
+	size, err := strconv.Atoi(options.Annotations[pkg.PodAddressWorkloadPoolSizeAnnotationKey])
+	if err != nil || size <= 0 {
+		return AcquiredAddress{}, newError(ErrInvalidParameter, "workload pool size %q is not a positive number", options.Annotations[pkg.PodAddressWorkloadPoolSizeAnnotationKey])
+	}
+	addrs, err := c.describeWorkloadAddresses(ctx, w.String())
+	if err != nil {
+		return AcquiredAddress{}, err
+	}
+	pool := fmt.Sprintf("%s=%s", pkg.TagWorkloadKey, w)
+	for _, addr := range addrs {
+		if _, ok := addr.tags[pkg.TagPodKey]; ok || addr.associationID != "" {
+			continue
+		}
+		exhausted.remove(pool)
+		if err := c.createTag(ctx, addr.allocationID, map[string]string{pkg.TagPodKey: options.PodKey}); err != nil {
+			return AcquiredAddress{}, err
+		}
+		return AcquiredAddress{AllocationID: addr.allocationID, PublicIP: addr.publicIP}, nil
+	}
+	if len(addrs) >= size {
+		exhausted.add(pool, poolSelector{selector: labels.SelectorFromValidatedSet(labels.Set{pkg.TagWorkloadKey: w.String()})})
+		return AcquiredAddress{}, PoolExhaustedError{
+			Selector: pool,
+			Total:    len(addrs),
+		}
+	}
+	exhausted.remove(pool)
+	return c.allocateWorkloadAddress(ctx, options, w)
+}
+
+// Release untags the pod, the address stays in the pool of the workload
+func (workloadProvider) Release(ctx context.Context, c EC2Client, addr address) ([]string, error) {
+	if err := c.deleteTag(ctx, addr.allocationID, []string{pkg.TagPodKey}); err != nil {
+		return nil, err
+	}
+	return exhausted.matching(addr.tags), nil
+}
+
+// allocateWorkloadAddress allocates an address for the pool of the workload, it falls back to the next pool of the
+// pool annotation like auto mode
+func (c EC2Client) allocateWorkloadAddress(ctx context.Context, options AssociateAddressOptions, w Workload) (AcquiredAddress, error) {
+	pools := addressPools(options.Annotations[pkg.PodAddressPoolAnnotationKey])
+	var err error
+	for i, pool := range pools {
+		input := &ec2.AllocateAddressInput{
+			TagSpecifications: []types.TagSpecification{
+				{
+					ResourceType: types.ResourceTypeElasticIp,
+					Tags: []types.Tag{
+						{Key: aws.String(pkg.TagTypeKey), Value: aws.String(pkg.PodEIPAnnotationValueWorkload)},
+						{Key: aws.String(pkg.TagClusterNameKey), Value: aws.String(c.clusterName)},
+						{Key: aws.String(pkg.TagPodKey), Value: aws.String(options.PodKey)},
+						{Key: aws.String(pkg.TagWorkloadKey), Value: aws.String(w.String())},
+					},
+				},
+			},
+		}
+		setAddressPool(input, pool)
+		var result *ec2.AllocateAddressOutput
+		result, err = c.callAllocateAddress(ctx, input)
+		if err == nil {
+			c.logger.Info(fmt.Sprintf("allocated address %s (allocation-id %s) for workload %s pool", aws.ToString(result.PublicIp), aws.ToString(result.AllocationId), w))
+			return AcquiredAddress{
+				AllocationID: aws.ToString(result.AllocationId),
+				PublicIP:     aws.ToString(result.PublicIp),
+				Labels:       map[string]string{pkg.PodAllocatedPoolLabel: pool},
+			}, nil
+		}
+		err = fmt.Errorf("allocate address pool %s workload %s: %w", pool, w, err)
+		if !errors.Is(err, ErrInsufficientCapacity) {
+			return AcquiredAddress{}, err
+		}
+		if i < len(pools)-1 {
+			c.logger.Warn(fmt.Sprintf("pool %s has no capacity for workload %s, falling back to pool %s: %v", pool, w, pools[i+1], err))
+		}
+	}
+	return AcquiredAddress{}, err
+}
+
+func (c EC2Client) callAllocateAddress(ctx context.Context, input *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 allocate-address --public-ipv4-pool amazon --tag-specifications ...
+	result, err := c.client.AllocateAddress(ctx, input)
+	if err != nil {
+		return nil, classify(err)
+	}
+	return result, nil
+}
+
+// DescribeWorkloadPools returns the number of addresses of the workload pools of the cluster
+func (c EC2Client) DescribeWorkloadPools(ctx context.Context) (map[Workload]int, error) {
+	addrs, err := c.describeWorkloadAddresses(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	pools := make(map[Workload]int)
+	for _, addr := range addrs {
+		if w, ok := parseWorkload(addr.tags[pkg.TagWorkloadKey]); ok {
+			pools[w]++
+		}
+	}
+	return pools, nil
+}
+
+// ReleaseWorkloadAddresses releases unassociated addresses of the workload pool until it has keep addresses, addresses
+// of pods are released once the pods are gone
+func (c EC2Client) ReleaseWorkloadAddresses(ctx context.Context, w Workload, keep int) (released int, err error) {
+	keyLocks.Lock(workloadLockKey(w))
+	defer keyLocks.Unlock(workloadLockKey(w))
+
+	addrs, err := c.describeWorkloadAddresses(ctx, w.String())
+	if err != nil {
+		return 0, err
+	}
+	for _, addr := range addrs {
+		if len(addrs)-released <= keep {
+			break
+		}
+		if _, ok := addr.tags[pkg.TagPodKey]; ok || addr.associationID != "" {
+			continue
+		}
+		if err := c.releaseAddress(ctx, addr.allocationID); err != nil {
+			return released, err
+		}
+		c.logger.Info(fmt.Sprintf("released address %s (allocation-id %s) of workload %s pool", addr.publicIP, addr.allocationID, w))
+		released++
+	}
+	return released, nil
+}
+
+// describeWorkloadAddresses returns the addresses of the workload pool of the cluster, of all workload pools if the
+// workload is empty
+func (c EC2Client) describeWorkloadAddresses(ctx context.Context, workload string) ([]address, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	filters := []types.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", pkg.TagClusterNameKey)),
+			Values: []string{c.clusterName},
+		},
+	}
+	if workload != "" {
+		filters = append(filters, types.Filter{Name: aws.String(fmt.Sprintf("tag:%s", pkg.TagWorkloadKey)), Values: []string{workload}})
+	} else {
+		filters = append(filters, types.Filter{Name: aws.String("tag-key"), Values: []string{pkg.TagWorkloadKey}})
+	}
+	result, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{Filters: filters})
+	if err != nil {
+		return nil, fmt.Errorf("describe address workload %q: %w", workload, classify(err))
+	}
+	var out []address
+	for _, v := range result.Addresses {
+		out = append(out, toAddress(v))
+	}
+	return out, nil
+}
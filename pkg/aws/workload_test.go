@@ -0,0 +1,74 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkloadOf(t *testing.T) {
+	for name, tc := range map[string]struct {
+		options AssociateAddressOptions
+		want    Workload
+		ok      bool
+	}{
+		"given StatefulSet pod when the workload is looked up then it is the StatefulSet": {
+			options: AssociateAddressOptions{PodKey: "game/server-3", OwnerKind: "StatefulSet", OwnerName: "server"},
+			want:    Workload{Kind: "StatefulSet", Namespace: "game", Name: "server"},
+			ok:      true,
+		},
+		"given ReplicaSet pod with the pod template hash when the workload is looked up then it is the Deployment": {
+			options: AssociateAddressOptions{
+				PodKey:    "game/lobby-5d8f9c-x2k4p",
+				OwnerKind: "ReplicaSet",
+				OwnerName: "lobby-5d8f9c",
+				Labels:    map[string]string{deploymentPodTemplateHashLabel: "5d8f9c"},
+			},
+			want: Workload{Kind: "Deployment", Namespace: "game", Name: "lobby"},
+			ok:   true,
+		},
+		"given ReplicaSet pod without the pod template hash when the workload is looked up then it has none": {
+			options: AssociateAddressOptions{PodKey: "game/lobby-x2k4p", OwnerKind: "ReplicaSet", OwnerName: "lobby"},
+		},
+		"given ReplicaSet pod whose name has not the pod template hash when the workload is looked up then it has none": {
+			options: AssociateAddressOptions{
+				PodKey:    "game/lobby-x2k4p",
+				OwnerKind: "ReplicaSet",
+				OwnerName: "lobby",
+				Labels:    map[string]string{deploymentPodTemplateHashLabel: "5d8f9c"},
+			},
+		},
+		"given pod of another owner when the workload is looked up then it has none": {
+			options: AssociateAddressOptions{PodKey: "game/agent-x2k4p", OwnerKind: "DaemonSet", OwnerName: "agent"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			workload, ok := workloadOf(tc.options)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.want, workload)
+		})
+	}
+}
+
+func TestParseWorkload(t *testing.T) {
+	t.Run("given workload when its tag value is parsed then it is the workload", func(t *testing.T) {
+		for _, workload := range []Workload{
+			{Kind: "StatefulSet", Namespace: "game", Name: "server"},
+			{Kind: "Deployment", Namespace: "default", Name: "lobby"},
+		} {
+			parsed, ok := parseWorkload(workload.String())
+			assert.True(t, ok, workload.String())
+			assert.Equal(t, workload, parsed)
+		}
+	})
+
+	t.Run("given tag value which is not a workload when it is parsed then it is invalid", func(t *testing.T) {
+		for _, s := range []string{"", "Deployment", "Deployment/default"} {
+			_, ok := parseWorkload(s)
+			assert.False(t, ok, s)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+const (
+	zoneTypeAvailabilityZone = "availability-zone"
+	zoneTypeWavelengthZone   = "wavelength-zone"
+)
+
+var zones = newZoneCache()
+
+// zone is the network border group of an availability zone, Local Zone or Wavelength Zone
+type zone struct {
+	name               string
+	zoneType           string
+	networkBorderGroup string
+}
+
+// borderGroup returns the network border group addresses have to be allocated in, empty for availability zones of
+// the region whose addresses are allocated without one
+func (z zone) borderGroup() string {
+	if z.zoneType == zoneTypeAvailabilityZone {
+		return ""
+	}
+	return z.networkBorderGroup
+}
+
+// carrier is true for Wavelength Zones, their addresses are carrier IPs of the carrier network
+func (z zone) carrier() bool {
+	return z.zoneType == zoneTypeWavelengthZone
+}
+
+// zoneCache are the zones which were described, they do not change
+type zoneCache struct {
+	lock  sync.Mutex
+	zones map[string]zone
+}
+
+func newZoneCache() *zoneCache {
+	return &zoneCache{zones: make(map[string]zone)}
+}
+
+func (z *zoneCache) get(name string) (zone, bool) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	v, ok := z.zones[name]
+	return v, ok
+}
+
+func (z *zoneCache) put(v zone) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	z.zones[v.name] = v
+}
+
+// describeZone returns the zone of a network interface, zones which are not opted in are described too. Without
+// permission to describe it the zone is an availability zone of the region, it is not cached so it is described again.
+func (c EC2Client) describeZone(ctx context.Context, name string) (zone, error) {
+	if v, ok := zones.get(name); ok {
+		return v, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// aws ec2 describe-availability-zones --zone-names us-east-1-wl1-bos-wlz-1 --all-availability-zones
+	result, err := c.client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		ZoneNames:            []string{name},
+		AllAvailabilityZones: aws.Bool(true),
+	})
+	if err != nil {
+		err = classify(err)
+		if errors.Is(err, ErrUnauthorized) {
+			// the permission was added with Local Zone support, addresses are allocated in the region without it
+			c.logger.Warn(fmt.Sprintf("describe availability zone %s is not authorized, allocating addresses in the region: %v", name, err))
+			return zone{name: name, zoneType: zoneTypeAvailabilityZone}, nil
+		}
+		return zone{}, fmt.Errorf("describe availability zone %s: %w", name, err)
+	}
+	if len(result.AvailabilityZones) == 0 {
+		return zone{}, newError(ErrNotFound, "no availability zone found for %s", name)
+	}
+	v := zone{
+		name:               name,
+		zoneType:           aws.ToString(result.AvailabilityZones[0].ZoneType),
+		networkBorderGroup: aws.ToString(result.AvailabilityZones[0].NetworkBorderGroup),
+	}
+	zones.put(v)
+	return v, nil
+}
@@ -0,0 +1,98 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+)
+
+func TestZone(t *testing.T) {
+	for name, tc := range map[string]struct {
+		zone        zone
+		borderGroup string
+		carrier     bool
+	}{
+		"given availability zone when the border group is looked up then addresses are allocated in the region": {
+			zone:        zone{name: "us-west-2a", zoneType: "availability-zone", networkBorderGroup: "us-west-2"},
+			borderGroup: "",
+		},
+		"given Local Zone when the border group is looked up then it is the border group of the zone": {
+			zone:        zone{name: "us-west-2-lax-1a", zoneType: "local-zone", networkBorderGroup: "us-west-2-lax-1"},
+			borderGroup: "us-west-2-lax-1",
+		},
+		"given Wavelength Zone when the border group is looked up then it is the carrier border group of the zone": {
+			zone:        zone{name: "us-east-1-wl1-bos-wlz-1", zoneType: "wavelength-zone", networkBorderGroup: "us-east-1-wl1-bos-wlz-1"},
+			borderGroup: "us-east-1-wl1-bos-wlz-1",
+			carrier:     true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.borderGroup, tc.zone.borderGroup())
+			assert.Equal(t, tc.carrier, tc.zone.carrier())
+		})
+	}
+}
+
+func TestEC2Client_describeZone(t *testing.T) {
+	t.Run("given Local Zone when it is described then it is cached", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAvailabilityZones": {testDescribeAvailabilityZones("us-west-2-lax-1a", "local-zone", "us-west-2-lax-1")},
+		})
+
+		for range 2 {
+			z, err := c.describeZone(context.Background(), "us-west-2-lax-1a")
+			assert.NoError(t, err)
+			assert.Equal(t, "us-west-2-lax-1", z.borderGroup())
+		}
+		assert.Equal(t, []string{"DescribeAvailabilityZones"}, endpoint.called())
+		assert.Equal(t, "true", endpoint.requested("DescribeAvailabilityZones")[0].Get("AllAvailabilityZones"))
+	})
+
+	t.Run("given no permission when a zone is described then it is an availability zone of the region which is not cached", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"DescribeAvailabilityZones": {testEC2Error("UnauthorizedOperation", "not authorized")},
+		})
+
+		for range 2 {
+			z, err := c.describeZone(context.Background(), "us-west-2-unauthorized-1a")
+			assert.NoError(t, err)
+			assert.Empty(t, z.borderGroup())
+			assert.False(t, z.carrier())
+		}
+		assert.Len(t, endpoint.called(), 2)
+	})
+
+	t.Run("given other error when a zone is described then it is returned", func(t *testing.T) {
+		c, _ := newTestEC2Client(t, map[string][]string{
+			"DescribeAvailabilityZones": {testEC2Error("RequestLimitExceeded", "throttled")},
+		})
+
+		_, err := c.describeZone(context.Background(), "us-west-2-throttled-1a")
+		assert.ErrorIs(t, err, ErrThrottled)
+	})
+}
+
+func TestAutoProvider_Acquire_carrier(t *testing.T) {
+	t.Run("given pod in a Wavelength Zone when address is acquired then a carrier IP of the border group is allocated", func(t *testing.T) {
+		c, endpoint := newTestEC2Client(t, map[string][]string{
+			"AllocateAddress": {testAllocateIP("eipalloc-1", "carrierIp", "155.146.1.1")},
+		})
+		options := testAutoOptions(map[string]string{pkg.PodAddressPoolAnnotationKey: "ipv4pool-ec2-1"})
+		options.NetworkBorderGroup, options.Carrier = "us-east-1-wl1-bos-wlz-1", true
+
+		acquired, err := autoProvider{}.Acquire(context.Background(), c, options)
+		assert.NoError(t, err)
+		assert.Equal(t, "155.146.1.1", acquired.PublicIP)
+		assert.Equal(t, "us-east-1-wl1-bos-wlz-1", acquired.Labels[pkg.PodNetworkBorderGroupLabel])
+		requests := endpoint.requested("AllocateAddress")
+		assert.Len(t, requests, 1)
+		assert.Equal(t, "us-east-1-wl1-bos-wlz-1", requests[0].Get("NetworkBorderGroup"))
+		assert.Empty(t, requests[0].Get("PublicIpv4Pool"))
+	})
+}
@@ -1,29 +1,82 @@
 package pkg
 
 const (
+	// Kubernetes annotation and label prefixes of all controller annotations and labels
+	PodAnnotationPrefix = "aws-samples.github.com/aws-pod-eip-controller-"
+	PodLabelPrefix      = "aws-pod-eip-controller-"
+
 	// Kubernetes annotations
-	PodEIPAnnotationKey                = "aws-samples.github.com/aws-pod-eip-controller-type"
-	PodEIPAnnotationValueAuto          = "auto"
-	PodEIPAnnotationValueFixedTag      = "fixed-tag"
-	PodEIPAnnotationValueFixedTagValue = "fixed-tag-value"
+	PodEIPAnnotationKey                  = "aws-samples.github.com/aws-pod-eip-controller-type"
+	PodEIPAnnotationValueAuto            = "auto"
+	PodEIPAnnotationValueFixedTag        = "fixed-tag"
+	PodEIPAnnotationValueFixedTagValue   = "fixed-tag-value"
+	PodEIPAnnotationValueFixedAllocation = "fixed-allocation"
+	PodEIPAnnotationValueWorkload        = "workload"
 
-	PodAddressPoolAnnotationKey          = "aws-samples.github.com/aws-pod-eip-controller-public-ipv4-pool"
+	// PodAddressPoolAnnotationKey is a comma separated list of pools auto mode addresses are allocated from, in order
+	PodAddressPoolAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-public-ipv4-pool"
+	// PodAddressIPAMPoolAnnotationKey is the IPAM pool ID auto mode addresses are allocated from before the public IPv4 pools,
+	// PodAddressIPAMAddressAnnotationKey the specific address of the IPAM pool, optionally with a /32 netmask
+	PodAddressIPAMPoolAnnotationKey    = "aws-samples.github.com/aws-pod-eip-controller-ipam-pool"
+	PodAddressIPAMAddressAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-ipam-address"
+	// PodAddressCoIPPoolAnnotationKey is the Outposts customer-owned IPv4 pool auto mode addresses are allocated from instead
+	// of the public IPv4 pools
+	PodAddressCoIPPoolAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-coip-pool"
+	// PodAddressStickyKeyAnnotationKey is the identity an auto mode address is kept for during the retain period, pods of
+	// the namespace with the same key reuse it. StatefulSet pods are identified by their name without one.
+	PodAddressStickyKeyAnnotationKey     = "aws-samples.github.com/aws-pod-eip-controller-sticky-key"
 	PodAddressFixedTagAnnotationKey      = "aws-samples.github.com/aws-pod-eip-controller-fixed-tag"
 	PodAddressFixedTagValueAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-fixed-tag-value"
+	// PodAddressFixedTagValueTemplateAnnotationKey is a Go template of the fixed-tag-value tag value, the pod key by default
+	PodAddressFixedTagValueTemplateAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-fixed-tag-value-template"
+	// PodAddressFixedAllocationAnnotationKey is the allocation ID or public IP of the address of a fixed-allocation mode pod
+	PodAddressFixedAllocationAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-fixed-allocation"
+	// PodAddressWorkloadPoolSizeAnnotationKey is the number of addresses of the pool of the workload owning a workload mode pod
+	PodAddressWorkloadPoolSizeAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-workload-pool-size"
+
+	// PodAddressFixedTagStrategyAnnotationKey is how an address is selected from the unassociated addresses of a fixed-tag pool
+	PodAddressFixedTagStrategyAnnotationKey = "aws-samples.github.com/aws-pod-eip-controller-fixed-tag-strategy"
+	FixedTagStrategyFirst                   = "first"
+	FixedTagStrategyRandom                  = "random"
+	FixedTagStrategyLeastRecentlyUsed       = "least-recently-used"
+	FixedTagStrategyLowestIP                = "lowest-ip"
 
 	// Kubernetes labels
 	PodPublicIPLabel         = "aws-pod-eip-controller-public-ip"
 	PodEIPAnnotationKeyLabel = "aws-pod-eip-controller-type"
 	PodAddressPoolIDLabel    = "aws-pod-eip-controller-public-ipv4-pool"
-	PodFixedTagLabel         = "aws-pod-eip-controller-fixed-tag"
-	PodFixedTagValueLabel    = "aws-pod-eip-controller-fixed-tag-value"
+	PodIPAMPoolLabel         = "aws-pod-eip-controller-ipam-pool"
+	PodIPAMAddressLabel      = "aws-pod-eip-controller-ipam-address"
+	PodCoIPPoolLabel         = "aws-pod-eip-controller-coip-pool"
+	PodStickyKeyLabel        = "aws-pod-eip-controller-sticky-key"
+	// PodCustomerOwnedIPLabel is the customer-owned IP of an auto mode address of a CoIP pool
+	PodCustomerOwnedIPLabel = "aws-pod-eip-controller-customer-owned-ip"
+	// PodAllocatedPoolLabel is the pool an auto mode address was allocated from
+	PodAllocatedPoolLabel         = "aws-pod-eip-controller-allocated-pool"
+	PodFixedTagLabel              = "aws-pod-eip-controller-fixed-tag"
+	PodFixedTagValueLabel         = "aws-pod-eip-controller-fixed-tag-value"
+	PodFixedTagValueTemplateLabel = "aws-pod-eip-controller-fixed-tag-value-template"
+	PodFixedAllocationLabel       = "aws-pod-eip-controller-fixed-allocation"
+	PodWorkloadPoolSizeLabel      = "aws-pod-eip-controller-workload-pool-size"
+	// PodNetworkBorderGroupLabel is the network border group of a Local Zone or Wavelength Zone address
+	PodNetworkBorderGroupLabel = "aws-pod-eip-controller-network-border-group"
+
+	// Kubernetes pod conditions
+	PodDeadLetterConditionType = "aws-samples.github.com/aws-pod-eip-controller-dead-letter"
 
 	// AWS Tags
 	TagTypeKey        = "aws-samples.github.com/aws-pod-eip-controller-type"
 	TagClusterNameKey = "aws-samples.github.com/aws-pod-eip-controller-cluster-name"
 	TagPodKey         = "aws-samples.github.com/aws-pod-eip-controller-pod"
+	// TagReleasedAtKey is when a fixed-tag mode address was last returned to its pool
+	TagReleasedAtKey = "aws-samples.github.com/aws-pod-eip-controller-released-at"
+	// TagWarmPoolKey is the public IPv4 pool of an auto mode address in the warm pool, TagWarmSinceKey when it was returned to it
+	TagWarmPoolKey  = "aws-samples.github.com/aws-pod-eip-controller-warm-pool"
+	TagWarmSinceKey = "aws-samples.github.com/aws-pod-eip-controller-warm-since"
+	// TagStickyKey is the identity of the pods an auto mode address is kept for, TagParkedSinceKey when it was parked for
+	// the next pod with the identity
+	TagStickyKey      = "aws-samples.github.com/aws-pod-eip-controller-sticky"
+	TagParkedSinceKey = "aws-samples.github.com/aws-pod-eip-controller-parked-since"
+	// TagWorkloadKey is the Deployment or StatefulSet of a workload mode address, kind/namespace/name
+	TagWorkloadKey = "aws-samples.github.com/aws-pod-eip-controller-workload"
 )
-
-func ValidPECType(pecType string) bool {
-	return pecType == PodEIPAnnotationValueAuto || pecType == PodEIPAnnotationValueFixedTag || pecType == PodEIPAnnotationValueFixedTagValue
-}
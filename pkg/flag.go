@@ -10,16 +10,57 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type Flags struct {
-	LogLevel       string
-	Kubeconfig     string
-	ClusterName    string
-	VpcID          string
-	Region         string
-	WatchNamespace string
-	ResyncPeriod   int
+	LogLevel    string
+	Kubeconfig  string
+	ClusterName string
+	VpcID       string
+	Region      string
+	// WatchNamespace and ExcludeNamespaces are comma separated lists
+	WatchNamespace    string
+	ExcludeNamespaces string
+	ResyncPeriod      int
+	// PodLabelSelector, PodFieldSelector and NamespaceLabelSelector limit the watched pods server-side
+	PodLabelSelector       string
+	PodFieldSelector       string
+	NamespaceLabelSelector string
+	// PendingPollPeriod in seconds
+	PendingPollPeriod int
+	// DeadLetterBaseDelay and DeadLetterMaxDelay in seconds
+	DeadLetterBaseDelay int
+	DeadLetterMaxDelay  int
+	MetricsAddress      string
+	// AssociationVerifyTimeout in seconds
+	AssociationVerifyTimeout int
+	ReplaceForeignAddresses  bool
+	EC2DescribeQPS           float64
+	EC2DescribeBurst         int
+	EC2MutateQPS             float64
+	EC2MutateBurst           int
+	// QueueBaseDelay in milliseconds, QueueMaxDelay in seconds
+	QueueBaseDelay  int
+	QueueMaxDelay   int
+	QueueQPS        float64
+	QueueBurst      int
+	MaxQueueRetries int
+	FairQueueBy     string
+	// WarmPools is a comma separated list of public IPv4 pool IDs, WarmPoolTTL in seconds
+	WarmPools       string
+	WarmPoolMinSize int
+	WarmPoolMaxSize int
+	WarmPoolTTL     int
+	// StickyRetainPeriod in seconds
+	StickyRetainPeriod int
+	Workers            int
+	// EC2CallTimeout, KubeCallTimeout and ShutdownTimeout in seconds
+	EC2CallTimeout  int
+	KubeCallTimeout int
+	ShutdownTimeout int
 }
 
 func (f Flags) SlogLevel() slog.Level {
@@ -36,6 +77,21 @@ func (f Flags) SlogLevel() slog.Level {
 	return slog.LevelInfo
 }
 
+// WatchNamespaces returns the namespaces to watch, empty for all namespaces
+func (f Flags) WatchNamespaces() []string {
+	return splitList(f.WatchNamespace)
+}
+
+// WarmPoolIDs returns the public IPv4 pool IDs with a warm pool
+func (f Flags) WarmPoolIDs() []string {
+	return splitList(f.WarmPools)
+}
+
+// ExcludedNamespaces returns the namespaces not to watch
+func (f Flags) ExcludedNamespaces() []string {
+	return splitList(f.ExcludeNamespaces)
+}
+
 func ParseFlags() Flags {
 	var flags Flags
 	f := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
@@ -44,8 +100,38 @@ func ParseFlags() Flags {
 	f.StringVar(&flags.ClusterName, "cluster-name", getStringEnv("PEC_CLUSTER_NAME", ""), "cluster name")
 	f.StringVar(&flags.VpcID, "vpc-id", getStringEnv("PEC_VPC_ID", ""), "AWS vpc id")
 	f.StringVar(&flags.Region, "region", getStringEnv("PEC_REGION", ""), "AWS region")
-	f.StringVar(&flags.WatchNamespace, "watch-namespace", getStringEnv("PEC_WATCH_NAMESPACE", ""), "namespace to watch, empty will watch all namespaces")
+	f.StringVar(&flags.WatchNamespace, "watch-namespace", getStringEnv("PEC_WATCH_NAMESPACE", ""), "comma separated namespaces to watch, empty will watch all namespaces")
+	f.StringVar(&flags.ExcludeNamespaces, "exclude-namespaces", getStringEnv("PEC_EXCLUDE_NAMESPACES", ""), "comma separated namespaces not to watch")
+	f.StringVar(&flags.PodLabelSelector, "pod-label-selector", getStringEnv("PEC_POD_LABEL_SELECTOR", ""), "label selector of pods to watch, empty will watch all pods")
+	f.StringVar(&flags.PodFieldSelector, "pod-field-selector", getStringEnv("PEC_POD_FIELD_SELECTOR", ""), "field selector of pods to watch, e.g. spec.nodeName or status.phase, empty will watch all pods")
+	f.StringVar(&flags.NamespaceLabelSelector, "namespace-label-selector", getStringEnv("PEC_NAMESPACE_LABEL_SELECTOR", ""), "label selector of namespaces whose pods are managed, empty will manage pods of all namespaces")
 	f.IntVar(&flags.ResyncPeriod, "resync-period", getIntEnv("PEC_RESYNC_PERIOD", 0), "resync period in seconds, 0 means no resync")
+	f.IntVar(&flags.PendingPollPeriod, "pending-poll-period", getIntEnv("PEC_PENDING_POLL_PERIOD", 60), "seconds between retries of pods waiting on an exhausted fixed-tag pool, 0 means retry only when the controller returns an address to the pool")
+
+	f.IntVar(&flags.QueueBaseDelay, "queue-base-delay-ms", getIntEnv("PEC_QUEUE_BASE_DELAY_MS", 5), "first retry delay in milliseconds of a failed pod, doubled on every retry")
+	f.IntVar(&flags.QueueMaxDelay, "queue-max-delay", getIntEnv("PEC_QUEUE_MAX_DELAY", 1000), "maximum retry delay in seconds of a failed pod")
+	f.Float64Var(&flags.QueueQPS, "queue-qps", getFloatEnv("PEC_QUEUE_QPS", 10), "overall retries per second of all failed pods")
+	f.IntVar(&flags.QueueBurst, "queue-burst", getIntEnv("PEC_QUEUE_BURST", 100), "overall retry burst of all failed pods")
+	f.IntVar(&flags.MaxQueueRetries, "max-queue-retries", getIntEnv("PEC_MAX_QUEUE_RETRIES", 3), "retries of a failed pod before it moves to the dead-letter queue, -1 retries forever")
+	f.StringVar(&flags.FairQueueBy, "fair-queue-by", getStringEnv("PEC_FAIR_QUEUE_BY", "namespace"), "round-robin queued pods between namespace, priority-class or none")
+	f.StringVar(&flags.WarmPools, "warm-pools", getStringEnv("PEC_WARM_POOLS", ""), "comma separated public IPv4 pool IDs with a warm pool of auto mode addresses, amazon for the Amazon pool")
+	f.IntVar(&flags.WarmPoolMinSize, "warm-pool-min-size", getIntEnv("PEC_WARM_POOL_MIN_SIZE", 0), "addresses allocated in advance in each warm pool")
+	f.IntVar(&flags.WarmPoolMaxSize, "warm-pool-max-size", getIntEnv("PEC_WARM_POOL_MAX_SIZE", 10), "maximum addresses of each warm pool, disassociated addresses are released when it is full")
+	f.IntVar(&flags.WarmPoolTTL, "warm-pool-ttl", getIntEnv("PEC_WARM_POOL_TTL", 600), "seconds addresses above the minimum size are kept in a warm pool before they are released")
+	f.IntVar(&flags.StickyRetainPeriod, "sticky-retain-period", getIntEnv("PEC_STICKY_RETAIN_PERIOD", 0), "seconds the auto mode address of a pod with a sticky identity is kept for the next pod with the identity, 0 releases it immediately")
+	f.IntVar(&flags.Workers, "workers", getIntEnv("PEC_WORKERS", 0), "maximum number of pods processed concurrently, 0 means unlimited")
+	f.IntVar(&flags.DeadLetterBaseDelay, "dead-letter-base-delay", getIntEnv("PEC_DEAD_LETTER_BASE_DELAY", 60), "first retry delay in seconds of pods which exceeded queue retries, doubled on every failed attempt")
+	f.IntVar(&flags.DeadLetterMaxDelay, "dead-letter-max-delay", getIntEnv("PEC_DEAD_LETTER_MAX_DELAY", 3600), "maximum retry delay in seconds of pods which exceeded queue retries")
+	f.IntVar(&flags.AssociationVerifyTimeout, "association-verify-timeout", getIntEnv("PEC_ASSOCIATION_VERIFY_TIMEOUT", 10), "seconds to wait for a new association to be visible before it is rolled back and retried, 0 disables the verification")
+	f.IntVar(&flags.EC2CallTimeout, "ec2-call-timeout", getIntEnv("PEC_EC2_CALL_TIMEOUT", 10), "timeout in seconds of every EC2 call")
+	f.IntVar(&flags.KubeCallTimeout, "kube-call-timeout", getIntEnv("PEC_KUBE_CALL_TIMEOUT", 10), "timeout in seconds of every pod patch")
+	f.IntVar(&flags.ShutdownTimeout, "shutdown-timeout", getIntEnv("PEC_SHUTDOWN_TIMEOUT", 30), "seconds in-flight pods may take on shutdown before they are cancelled")
+	f.BoolVar(&flags.ReplaceForeignAddresses, "replace-foreign-addresses", getBoolEnv("PEC_REPLACE_FOREIGN_ADDRESSES", false), "replace addresses not owned by the controller which are associated to a pod private IP")
+	f.Float64Var(&flags.EC2DescribeQPS, "ec2-describe-qps", getFloatEnv("PEC_EC2_DESCRIBE_QPS", 10), "client-side rate limit of EC2 Describe* calls per second, 0 disables the limit")
+	f.IntVar(&flags.EC2DescribeBurst, "ec2-describe-burst", getIntEnv("PEC_EC2_DESCRIBE_BURST", 20), "client-side burst of EC2 Describe* calls")
+	f.Float64Var(&flags.EC2MutateQPS, "ec2-mutate-qps", getFloatEnv("PEC_EC2_MUTATE_QPS", 5), "client-side rate limit of mutating EC2 calls per second, 0 disables the limit")
+	f.IntVar(&flags.EC2MutateBurst, "ec2-mutate-burst", getIntEnv("PEC_EC2_MUTATE_BURST", 10), "client-side burst of mutating EC2 calls")
+	f.StringVar(&flags.MetricsAddress, "metrics-address", getStringEnv("PEC_METRICS_ADDRESS", ""), "address to serve metrics on /debug/vars, empty disables metrics")
 
 	if err := f.Parse(os.Args[1:]); err != nil {
 		fmt.Printf("parse flags: %v", err)
@@ -55,6 +141,53 @@ func ParseFlags() Flags {
 		fmt.Printf("invalid log level %s", flags.LogLevel)
 		os.Exit(1)
 	}
+	if flags.QueueBaseDelay <= 0 || flags.QueueMaxDelay <= 0 || flags.QueueQPS <= 0 || flags.QueueBurst <= 0 || flags.MaxQueueRetries < -1 {
+		fmt.Printf("invalid queue settings, base delay %d max delay %d qps %f burst %d max retries %d",
+			flags.QueueBaseDelay, flags.QueueMaxDelay, flags.QueueQPS, flags.QueueBurst, flags.MaxQueueRetries)
+		os.Exit(1)
+	}
+	if flags.EC2DescribeQPS < 0 || (flags.EC2DescribeQPS > 0 && flags.EC2DescribeBurst <= 0) ||
+		flags.EC2MutateQPS < 0 || (flags.EC2MutateQPS > 0 && flags.EC2MutateBurst <= 0) {
+		fmt.Printf("invalid ec2 rate limits, describe qps %f burst %d mutate qps %f burst %d",
+			flags.EC2DescribeQPS, flags.EC2DescribeBurst, flags.EC2MutateQPS, flags.EC2MutateBurst)
+		os.Exit(1)
+	}
+	if flags.FairQueueBy != "none" && flags.FairQueueBy != "namespace" && flags.FairQueueBy != "priority-class" {
+		fmt.Printf("invalid fair queue by %s, must be none, namespace or priority-class", flags.FairQueueBy)
+		os.Exit(1)
+	}
+	if flags.WarmPoolMinSize < 0 || flags.WarmPoolMaxSize < flags.WarmPoolMinSize || flags.WarmPoolTTL < 0 {
+		fmt.Printf("invalid warm pool settings, min size %d max size %d ttl %d", flags.WarmPoolMinSize, flags.WarmPoolMaxSize, flags.WarmPoolTTL)
+		os.Exit(1)
+	}
+	if flags.StickyRetainPeriod < 0 {
+		fmt.Printf("invalid sticky retain period %d", flags.StickyRetainPeriod)
+		os.Exit(1)
+	}
+	if flags.EC2CallTimeout <= 0 || flags.KubeCallTimeout <= 0 || flags.ShutdownTimeout < 0 {
+		fmt.Printf("invalid timeouts, ec2 call %d kube call %d shutdown %d", flags.EC2CallTimeout, flags.KubeCallTimeout, flags.ShutdownTimeout)
+		os.Exit(1)
+	}
+	if flags.Workers < 0 {
+		fmt.Printf("invalid workers %d", flags.Workers)
+		os.Exit(1)
+	}
+	if _, err := labels.Parse(flags.PodLabelSelector); err != nil {
+		fmt.Printf("invalid pod label selector %s: %v", flags.PodLabelSelector, err)
+		os.Exit(1)
+	}
+	if _, err := fields.ParseSelector(flags.PodFieldSelector); err != nil {
+		fmt.Printf("invalid pod field selector %s: %v", flags.PodFieldSelector, err)
+		os.Exit(1)
+	}
+	if _, err := labels.Parse(flags.NamespaceLabelSelector); err != nil {
+		fmt.Printf("invalid namespace label selector %s: %v", flags.NamespaceLabelSelector, err)
+		os.Exit(1)
+	}
+	if flags.DeadLetterBaseDelay <= 0 || flags.DeadLetterMaxDelay < flags.DeadLetterBaseDelay {
+		fmt.Printf("invalid dead letter delays, base %d max %d", flags.DeadLetterBaseDelay, flags.DeadLetterMaxDelay)
+		os.Exit(1)
+	}
 	if flags.ClusterName == "" {
 		fmt.Println("cluster name is not set")
 		os.Exit(1)
@@ -62,6 +195,17 @@ func ParseFlags() Flags {
 	return flags
 }
 
+// splitList returns the trimmed non-empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getStringEnv(envName string, defaultValue string) string {
 	if env, ok := os.LookupEnv(envName); ok {
 		return env
@@ -69,6 +213,24 @@ func getStringEnv(envName string, defaultValue string) string {
 	return defaultValue
 }
 
+func getBoolEnv(envName string, defaultValue bool) bool {
+	if env, ok := os.LookupEnv(envName); ok {
+		if boolVar, err := strconv.ParseBool(env); err == nil {
+			return boolVar
+		}
+	}
+	return defaultValue
+}
+
+func getFloatEnv(envName string, defaultValue float64) float64 {
+	if env, ok := os.LookupEnv(envName); ok {
+		if floatVar, err := strconv.ParseFloat(env, 64); err == nil {
+			return floatVar
+		}
+	}
+	return defaultValue
+}
+
 func getIntEnv(envName string, defaultValue int) int {
 	if env, ok := os.LookupEnv(envName); ok {
 		if IntVar, err := strconv.Atoi(env); err == nil {
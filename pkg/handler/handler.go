@@ -5,22 +5,33 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws-samples/aws-pod-eip-controller/pkg"
 	"github.com/aws-samples/aws-pod-eip-controller/pkg/aws"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	clientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 )
 
 type ENIClient interface {
-	AssociateAddress(aws.AssociateAddressOptions) (string, error)
-	DisassociateAddress(aws.DisassociateAddressOptions) error
+	AssociateAddress(context.Context, aws.AssociateAddressOptions) (aws.AssociateAddressResult, error)
+	DisassociateAddress(context.Context, aws.DisassociateAddressOptions) (aws.DisassociateAddressResult, error)
+	DescribeAssociations(context.Context) (aws.Associations, error)
 }
 
 type Handler struct {
@@ -28,44 +39,90 @@ type Handler struct {
 	coreClient    clientv1.CoreV1Interface
 	eniClient     ENIClient
 	eventRecorder record.EventRecorder
+	// callTimeout is the timeout of every Kubernetes API call
+	callTimeout  time.Duration
+	poolReleased func(pool string)
+	// drifted are the pods found out of sync by Reconcile, they are processed once even without changes
+	drifted     map[string]struct{}
+	driftedLock sync.Mutex
 }
 
-func NewHandler(logger *slog.Logger, coreClient clientv1.CoreV1Interface, eniClient ENIClient, eventRecorder record.EventRecorder) *Handler {
+func NewHandler(logger *slog.Logger, coreClient clientv1.CoreV1Interface, eniClient ENIClient, eventRecorder record.EventRecorder, callTimeout time.Duration) *Handler {
 	h := &Handler{
 		logger:        logger.With("component", "handler"),
 		coreClient:    coreClient,
 		eniClient:     eniClient,
 		eventRecorder: eventRecorder,
+		callTimeout:   callTimeout,
+		drifted:       make(map[string]struct{}),
 	}
 	return h
 }
 
-func (h *Handler) AddOrUpdate(key string, pod v1.Pod) error {
+// OnPoolRelease registers a function which is called for every pool an address has been returned to
+func (h *Handler) OnPoolRelease(f func(pool string)) {
+	h.poolReleased = f
+}
+
+// releasedToPools notifies about addresses returned to the pools
+func (h *Handler) releasedToPools(pools []string) {
+	if h.poolReleased == nil {
+		return
+	}
+	for _, pool := range pools {
+		h.poolReleased(pool)
+	}
+}
+
+func (h *Handler) AddOrUpdate(ctx context.Context, key string, pod v1.Pod) error {
 	if pod.Status.PodIP == "" {
 		h.logger.Debug(fmt.Sprintf("pod %s in phase %s does not have IP, skipping", key, pod.Status.Phase))
 		return nil
 	}
 
 	event := NewPodEvent(key, pod)
-	if !h.hasChange(event) {
+	if !h.hasChange(event) && !h.takeDrifted(key) {
 		h.logger.Debug(fmt.Sprintf("pod %s has not change", event.Key))
 		return nil
 	}
 	h.logger.Info(fmt.Sprintf("received pod add/update %s phase %s IP %s", key, pod.Status.Phase, pod.Status.PodIP))
-	if err := h.addOrUpdateEvent(event); err != nil {
+	if err := h.addOrUpdateEvent(ctx, event); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (h *Handler) Delete(key string) error {
+func (h *Handler) Delete(ctx context.Context, key string) error {
 	h.logger.Info(fmt.Sprintf("received pod delete %s", key))
-	if err := h.DisassociateAddress(NewPodEvent(key, v1.Pod{})); err != nil {
+	h.takeDrifted(key)
+	if err := h.DisassociateAddress(ctx, NewPodEvent(key, v1.Pod{})); err != nil {
 		return err
 	}
 	return nil
 }
 
+// DeadLetter sets the dead-letter condition on the pod, so it is visible which pods are stuck and why
+func (h *Handler) DeadLetter(ctx context.Context, key string, attempts int, err error) error {
+	condition := map[string]any{
+		"type":    pkg.PodDeadLetterConditionType,
+		"status":  v1.ConditionTrue,
+		"reason":  "RetriesExhausted",
+		"message": fmt.Sprintf("Failed %d times after queue retries were exceeded: %v", attempts, err),
+	}
+	if attempts == 1 {
+		condition["lastTransitionTime"] = metav1.Now()
+	}
+	return h.patchPodCondition(ctx, key, condition)
+}
+
+// Recovered removes the dead-letter condition from the pod
+func (h *Handler) Recovered(ctx context.Context, key string) error {
+	return h.patchPodCondition(ctx, key, map[string]any{
+		"type":   pkg.PodDeadLetterConditionType,
+		"$patch": "delete",
+	})
+}
+
 // hasChange checks if the pod event is the same
 func (h *Handler) hasChange(event PodEvent) bool {
 	pecAnnotation, _ := event.GetPECTypeAnnotation()
@@ -74,43 +131,29 @@ func (h *Handler) hasChange(event PodEvent) bool {
 		h.logger.Debug(fmt.Sprintf("pec type annotation %s and label %s are different", pecAnnotation, pecLabel))
 		return true
 	}
-	switch pecAnnotation {
-	// if the pod has auto annotation, check if the address pool id or fixed tag has changed
-	case pkg.PodEIPAnnotationValueAuto:
-		addressPoolIDAnnotation, _ := event.GetAddressPoolIdAnnotation()
-		addressPoolIDLabel, _ := event.GetAddressPoolIdLabel()
-		if addressPoolIDAnnotation != addressPoolIDLabel {
-			h.logger.Debug(fmt.Sprintf("address pool id annotation %s and label %s are different", addressPoolIDAnnotation, addressPoolIDLabel))
-			return true
-		}
-	// if the pod has fixed tag annotation, check if the fixed tag has changed
-	case pkg.PodEIPAnnotationValueFixedTag:
-		fixedTagAnnotation, _ := event.GetFixedTagAnnotation()
-		fixedTagLabel, _ := event.GetFixedTagLabel()
-		if fixedTagAnnotation != fixedTagLabel {
-			h.logger.Debug(fmt.Sprintf("fixed tag annotation %s and label %s are different", fixedTagAnnotation, fixedTagLabel))
-			return true
-		}
-	case pkg.PodEIPAnnotationValueFixedTagValue:
-		fixedTagValueAnnotation, _ := event.GetFixedTagValueAnnotation()
-		fixedTagValueLabel, _ := event.GetFixedTagValueLabel()
-		if fixedTagValueAnnotation != fixedTagValueLabel {
-			h.logger.Debug(fmt.Sprintf("fixed tag value annotation %s and label %s are different", fixedTagValueAnnotation, fixedTagValueLabel))
+	provider, ok := aws.GetAddressProvider(pecAnnotation)
+	if !ok {
+		return false
+	}
+	// check if an annotation the address was acquired for has changed
+	for _, key := range provider.DesiredState() {
+		if stateLabelValue(event.Annotations[key.Annotation]) != event.Labels[key.Label] {
+			h.logger.Debug(fmt.Sprintf("annotation %s %s and label %s %s are different", key.Annotation, event.Annotations[key.Annotation], key.Label, event.Labels[key.Label]))
 			return true
 		}
 	}
 	return false
 }
 
-func (h *Handler) addOrUpdateEvent(event PodEvent) error {
+func (h *Handler) addOrUpdateEvent(ctx context.Context, event PodEvent) error {
 	// DisassociateAddress
-	if err := h.DisassociateAddress(event); err != nil {
+	if err := h.DisassociateAddress(ctx, event); err != nil {
 		h.logger.Error(fmt.Sprintf("disassociate address for pod: %s fail: %v", event.Key, err))
 		return err
 	}
 
 	// AssociateAddress
-	err := h.AssociateAddress(event)
+	err := h.AssociateAddress(ctx, event)
 	if err != nil {
 		h.logger.Error(fmt.Sprintf("associate address for pod: %s fail: %v", event.Key, err))
 		return err
@@ -118,155 +161,196 @@ func (h *Handler) addOrUpdateEvent(event PodEvent) error {
 	return nil
 }
 
-func (h *Handler) DisassociateAddress(event PodEvent) error {
-	if err := h.eniClient.DisassociateAddress(aws.DisassociateAddressOptions{
+func (h *Handler) DisassociateAddress(ctx context.Context, event PodEvent) error {
+	result, err := h.eniClient.DisassociateAddress(ctx, aws.DisassociateAddressOptions{
 		PodKey: event.Key,
-	}); err != nil {
-		h.recordEvent(event, v1.EventTypeWarning, "EIPDisassociationFailed", fmt.Sprintf("Failed to disassociate EIP: %v", err))
+	})
+	if err != nil {
+		// cancelled on shutdown, the pod is processed again after restart
+		if ctx.Err() == nil {
+			h.recordEvent(event, v1.EventTypeWarning, failureReason("EIPDisassociation", err), fmt.Sprintf("Failed to disassociate EIP: %v", err))
+		}
 		return fmt.Errorf("disassociate address %s: %w", event.Key, err)
 	}
 	h.logger.Debug(fmt.Sprintf("disassociate address from pod %s", event.Key))
+	h.releasedToPools(result.Pools)
 	h.recordEvent(event, v1.EventTypeNormal, "EIPDisassociated", "Successfully disassociated EIP from Pod")
-	// remove all relate labels
+	// remove all controller labels
 	labelPatches := make([]labelPatch, 0)
-	if _, exist := event.GetPECTypeLabel(); exist {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:   "remove",
-			Path: fmt.Sprintf("/metadata/labels/%s", pkg.PodEIPAnnotationKeyLabel),
-		})
-	}
-	if _, exist := event.GetAddressPoolIdLabel(); exist {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:   "remove",
-			Path: fmt.Sprintf("/metadata/labels/%s", pkg.PodAddressPoolIDLabel),
-		})
-	}
-	if _, exist := event.GetPublicIPLabel(); exist {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:   "remove",
-			Path: fmt.Sprintf("/metadata/labels/%s", pkg.PodPublicIPLabel),
-		})
-	}
-	if _, exist := event.GetFixedTagLabel(); exist {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:   "remove",
-			Path: fmt.Sprintf("/metadata/labels/%s", pkg.PodFixedTagLabel),
-		})
-	}
-	if _, exist := event.GetFixedTagValueLabel(); exist {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:   "remove",
-			Path: fmt.Sprintf("/metadata/labels/%s", pkg.PodFixedTagValueLabel),
-		})
+	for _, key := range slices.Sorted(maps.Keys(event.Labels)) {
+		if strings.HasPrefix(key, pkg.PodLabelPrefix) {
+			labelPatches = append(labelPatches, labelPatch{
+				Op:   "remove",
+				Path: labelPath(key),
+			})
+		}
 	}
 	if len(labelPatches) == 0 {
 		return nil
 	}
-	if err := h.patchPodLabel(event, labelPatches); err != nil {
+	if err := h.patchPodLabel(ctx, event, labelPatches); err != nil {
 		return fmt.Errorf("patch pod %s: %w", event.Key, err)
 	}
 	return nil
 }
 
-func (h *Handler) AssociateAddress(event PodEvent) error {
+func (h *Handler) AssociateAddress(ctx context.Context, event PodEvent) error {
 	pecType, _ := event.GetPECTypeAnnotation()
-	if !pkg.ValidPECType(pecType) {
+	provider, ok := aws.GetAddressProvider(pecType)
+	if !ok {
 		h.logger.Info(fmt.Sprintf("invalid pec type %s for pod %s", pecType, event.Key))
 		return nil
 	}
 
-	addressPoolID, _ := event.GetAddressPoolIdAnnotation()
-	addressPoolIDTmp := addressPoolID
-	if addressPoolIDTmp == "" {
-		addressPoolIDTmp = "amazon"
-	}
-	tagKey, _ := event.GetFixedTagAnnotation()
-	tagValueKey, _ := event.GetFixedTagValueAnnotation()
-	publicIP, err := h.eniClient.AssociateAddress(aws.AssociateAddressOptions{
-		PodKey:        event.Key,
-		PodIP:         event.IP,
-		HostIP:        event.HostIP,
-		AddressPoolId: addressPoolIDTmp,
-		PECType:       pecType,
-		TagKey:        tagKey,
-		TagValueKey:   tagValueKey,
+	result, err := h.eniClient.AssociateAddress(ctx, aws.AssociateAddressOptions{
+		PodKey:      event.Key,
+		PodIP:       event.IP,
+		HostIP:      event.HostIP,
+		PECType:     pecType,
+		Annotations: event.Annotations,
+		Labels:      event.Labels,
+		OwnerKind:   event.OwnerKind,
+		OwnerName:   event.OwnerName,
 	})
+	// addresses are displaced even if the association fails afterwards
+	for _, displaced := range result.Displaced {
+		owner := "not owned by the controller"
+		if displaced.Owner != "" {
+			owner = fmt.Sprintf("owned by pod %s", displaced.Owner)
+		}
+		h.recordEvent(event, v1.EventTypeNormal, "EIPDisplaced", fmt.Sprintf("Replaced EIP %s (%s) %s which was associated to the Pod IP", displaced.PublicIP, displaced.AllocationID, owner))
+	}
+	h.releasedToPools(result.Pools)
+	var exhausted aws.PoolExhaustedError
+	if errors.As(err, &exhausted) {
+		h.recordEvent(event, v1.EventTypeWarning, "EIPPending", pendingMessage(exhausted))
+		return fmt.Errorf("associate address %s: %w", event.Key, err)
+	}
 	if err != nil {
-		h.recordEvent(event, v1.EventTypeWarning, "EIPAssociationFailed", fmt.Sprintf("Failed to associate EIP (%s mode): %v", pecType, err))
+		if ctx.Err() == nil {
+			h.recordEvent(event, v1.EventTypeWarning, failureReason("EIPAssociation", err), fmt.Sprintf("Failed to associate EIP (%s mode): %v", pecType, err))
+		}
 		return fmt.Errorf("associate address %s: %w", event.Key, err)
 	}
+	publicIP := result.PublicIP
 	h.logger.Debug(fmt.Sprintf("associate address %s to pod %s", publicIP, event.Key))
 	h.recordEvent(event, v1.EventTypeNormal, "EIPAssociated", fmt.Sprintf("Successfully associated EIP %s (%s mode)", publicIP, pecType))
 
-	// add labels
-	labelPatches := make([]labelPatch, 0)
-	if pecType == pkg.PodEIPAnnotationValueAuto {
-		if addressPoolID > "" {
-			labelPatches = append(labelPatches, labelPatch{
-				Op:    "add",
-				Path:  fmt.Sprintf("/metadata/labels/%s", pkg.PodAddressPoolIDLabel),
-				Value: addressPoolID,
-			})
-		}
+	// add labels, the desired state labels record the annotations the address was acquired for
+	labels := map[string]string{
+		pkg.PodEIPAnnotationKeyLabel: pecType,
+		pkg.PodPublicIPLabel:         publicIP,
 	}
-	if pecType == pkg.PodEIPAnnotationValueFixedTag {
-		if tagKey > "" {
-			labelPatches = append(labelPatches, labelPatch{
-				Op:    "add",
-				Path:  fmt.Sprintf("/metadata/labels/%s", pkg.PodFixedTagLabel),
-				Value: tagKey,
-			})
-		}
+	for _, key := range provider.DesiredState() {
+		labels[key.Label] = stateLabelValue(event.Annotations[key.Annotation])
 	}
-	if pecType == pkg.PodEIPAnnotationValueFixedTagValue {
-		if tagValueKey > "" {
+	maps.Copy(labels, result.Labels)
+	labelPatches := make([]labelPatch, 0)
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if labels[key] > "" {
 			labelPatches = append(labelPatches, labelPatch{
 				Op:    "add",
-				Path:  fmt.Sprintf("/metadata/labels/%s", pkg.PodFixedTagValueLabel),
-				Value: tagValueKey,
+				Path:  labelPath(key),
+				Value: labels[key],
 			})
 		}
 	}
-	if pecType > "" {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:    "add",
-			Path:  fmt.Sprintf("/metadata/labels/%s", pkg.PodEIPAnnotationKeyLabel),
-			Value: pecType,
-		})
-	}
-	if publicIP > "" {
-		labelPatches = append(labelPatches, labelPatch{
-			Op:    "add",
-			Path:  fmt.Sprintf("/metadata/labels/%s", pkg.PodPublicIPLabel),
-			Value: publicIP,
-		})
-	}
 	if len(labelPatches) == 0 {
 		return nil
 	}
-	if err := h.patchPodLabel(event, labelPatches); err != nil {
+	if err := h.patchPodLabel(ctx, event, labelPatches); err != nil {
 		return fmt.Errorf("patch pod %s: %w", event.Key, err)
 	}
 	return nil
 }
 
+// pendingMessage returns the event message of a pod waiting on an exhausted pool
+func pendingMessage(exhausted aws.PoolExhaustedError) string {
+	if exhausted.Total == 0 {
+		return fmt.Sprintf("Waiting for an address in %s pool, the pool has no addresses", exhausted.Selector)
+	}
+	return fmt.Sprintf("Waiting for an address in %s pool, all %d addresses in use", exhausted.Selector, exhausted.Total)
+}
+
+// failureReason returns the event reason for the kind of the error, e.g. EIPAssociationThrottled
+func failureReason(prefix string, err error) string {
+	switch {
+	case errors.Is(err, aws.ErrThrottled):
+		return prefix + "Throttled"
+	case errors.Is(err, aws.ErrQuotaExceeded):
+		return prefix + "QuotaExceeded"
+	case errors.Is(err, aws.ErrNotFound):
+		return prefix + "NotFound"
+	case errors.Is(err, aws.ErrInvalidParameter):
+		return prefix + "InvalidParameter"
+	case errors.Is(err, aws.ErrUnauthorized):
+		return prefix + "Unauthorized"
+	case errors.Is(err, aws.ErrConflict):
+		return prefix + "Conflict"
+	case errors.Is(err, aws.ErrInsufficientCapacity):
+		return prefix + "InsufficientCapacity"
+	}
+	return prefix + "Failed"
+}
+
 type labelPatch struct {
 	Op    string `json:"op"`
 	Path  string `json:"path"`
 	Value string `json:"value,omitempty"`
 }
 
-func (h *Handler) patchPodLabel(event PodEvent, lables []labelPatch) error {
+// stateLabelValue returns the label value recording an annotation value, a hash if the annotation value is not a
+// valid label value, e.g. a tag selector
+func stateLabelValue(annotation string) string {
+	if len(validation.IsValidLabelValue(annotation)) == 0 {
+		return annotation
+	}
+	return fmt.Sprintf("sha256-%x", sha256.Sum256([]byte(annotation)))[:39]
+}
+
+// labelPath returns the JSON patch path of a label, escaping the slash of prefixed keys
+func labelPath(key string) string {
+	return "/metadata/labels/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func (h *Handler) patchPodLabel(ctx context.Context, event PodEvent, lables []labelPatch) error {
 	patch, err := json.Marshal(lables)
 	if err != nil {
 		return fmt.Errorf("marshal patch: %w", err)
 	}
-	if _, err := h.coreClient.Pods(event.Namespace).Patch(context.Background(), event.Name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+	ctx, cancel := context.WithTimeout(ctx, h.callTimeout)
+	defer cancel()
+	if _, err := h.coreClient.Pods(event.Namespace).Patch(ctx, event.Name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
 		return fmt.Errorf("patch pod %s, %s error: %w", event.Key, patch, err)
 	}
 	return nil
 }
 
+func (h *Handler) patchPodCondition(ctx context.Context, key string, condition map[string]any) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("split key %s: %w", key, err)
+	}
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"conditions": []map[string]any{condition},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal patch: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.callTimeout)
+	defer cancel()
+	if _, err := h.coreClient.Pods(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status"); err != nil {
+		if apierrors.IsNotFound(err) {
+			h.logger.Debug(fmt.Sprintf("pod %s not found, skipping condition patch", key))
+			return nil
+		}
+		return fmt.Errorf("patch pod %s status, %s error: %w", key, patch, err)
+	}
+	return nil
+}
+
 func (h *Handler) recordEvent(event PodEvent, eventType, reason, message string) {
 	if h.eventRecorder != nil {
 		pod := &v1.Pod{
@@ -0,0 +1,121 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var noOpLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+func TestLabelPath(t *testing.T) {
+	t.Run("given label keys when the patch path is built then slashes and tildes are escaped", func(t *testing.T) {
+		for key, path := range map[string]string{
+			"app":                        "/metadata/labels/app",
+			pkg.PodPublicIPLabel:         "/metadata/labels/" + pkg.PodPublicIPLabel,
+			"example.com/name":           "/metadata/labels/example.com~1name",
+			"example.com/name~v1":        "/metadata/labels/example.com~1name~0v1",
+			"example.com/a/b":            "/metadata/labels/example.com~1a~1b",
+			"aws-samples.github.com/pec": "/metadata/labels/aws-samples.github.com~1pec",
+		} {
+			assert.Equal(t, path, labelPath(key), key)
+		}
+	})
+}
+
+func TestHandler_hasChange(t *testing.T) {
+	h := &Handler{logger: noOpLogger}
+	event := func(annotations, labels map[string]string) PodEvent {
+		return PodEvent{Key: "default/test", Annotations: annotations, Labels: labels}
+	}
+
+	for name, tc := range map[string]struct {
+		event PodEvent
+		want  bool
+	}{
+		"given pod with eip annotation when it has no type label then it has changed": {
+			event: event(map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto}, nil),
+			want:  true,
+		},
+		"given pod with type label when eip annotation is removed then it has changed": {
+			event: event(nil, map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueAuto}),
+			want:  true,
+		},
+		"given pod with type label when eip annotation changes mode then it has changed": {
+			event: event(
+				map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueFixedTag, pkg.PodAddressFixedTagAnnotationKey: "pool"},
+				map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueAuto},
+			),
+			want: true,
+		},
+		"given pod with type label when it has no desired state annotations then it has not changed": {
+			event: event(
+				map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto},
+				map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueAuto},
+			),
+			want: false,
+		},
+		"given pod with type label when a desired state annotation is added then it has changed": {
+			event: event(
+				map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto, pkg.PodAddressPoolAnnotationKey: "ipv4pool-ec2-1"},
+				map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueAuto},
+			),
+			want: true,
+		},
+		"given pod with desired state label when the annotation is the same then it has not changed": {
+			event: event(
+				map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueFixedTag, pkg.PodAddressFixedTagAnnotationKey: "pool"},
+				map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueFixedTag, pkg.PodFixedTagLabel: "pool"},
+			),
+			want: false,
+		},
+		"given pod with desired state label when the annotation changes then it has changed": {
+			event: event(
+				map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueFixedTag, pkg.PodAddressFixedTagAnnotationKey: "other"},
+				map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueFixedTag, pkg.PodFixedTagLabel: "pool"},
+			),
+			want: true,
+		},
+		"given pod with desired state annotation of another mode when it is added then it has not changed": {
+			event: event(
+				map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto, pkg.PodAddressFixedTagAnnotationKey: "pool"},
+				map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueAuto},
+			),
+			want: false,
+		},
+		"given pod with unknown eip annotation when it has no type label then it has not changed": {
+			event: event(map[string]string{pkg.PodEIPAnnotationKey: "unknown"}, nil),
+			want:  false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, h.hasChange(tc.event))
+		})
+	}
+}
+
+func TestStateLabelValue(t *testing.T) {
+	t.Run("given valid label values when they are recorded then they are kept", func(t *testing.T) {
+		for _, annotation := range []string{"", "pool", "ipv4pool-ec2-1", "amazon", "Deployment.web_1"} {
+			assert.Equal(t, annotation, stateLabelValue(annotation))
+		}
+	})
+
+	t.Run("given annotations which are not label values when they are recorded then a stable hash is recorded", func(t *testing.T) {
+		for _, annotation := range []string{"pool=egress,region-group in (eu,us)", "team:egress", "a/b", strings.Repeat("a", 64)} {
+			value := stateLabelValue(annotation)
+			assert.Empty(t, validation.IsValidLabelValue(value), annotation)
+			assert.True(t, strings.HasPrefix(value, "sha256-"), annotation)
+			assert.Equal(t, value, stateLabelValue(annotation), annotation)
+		}
+		assert.NotEqual(t, stateLabelValue("pool=egress"), stateLabelValue("pool=ingress"))
+	})
+}
@@ -1,10 +1,10 @@
 package handler
 
 import (
-	"strings"
-
 	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+	"github.com/aws-samples/aws-pod-eip-controller/pkg/aws"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type PodEvent struct {
@@ -17,11 +17,14 @@ type PodEvent struct {
 	IP              string
 	HostIP          string
 	ResourceVersion string
+	// OwnerKind and OwnerName are the controller owner reference of the pod, empty without one
+	OwnerKind string
+	OwnerName string
 }
 
 func (p PodEvent) GetPECTypeAnnotation() (string, bool) {
 	if v, ok := p.Annotations[pkg.PodEIPAnnotationKey]; ok {
-		if pkg.ValidPECType(v) {
+		if aws.ValidPECType(v) {
 			return v, true
 		}
 	}
@@ -35,54 +38,6 @@ func (p PodEvent) GetPECTypeLabel() (string, bool) {
 	return "", false
 }
 
-func (p PodEvent) GetAddressPoolIdAnnotation() (string, bool) {
-	if v, ok := p.Annotations[pkg.PodAddressPoolAnnotationKey]; ok {
-		return v, true
-	}
-	return "", false
-}
-
-func (p PodEvent) GetAddressPoolIdLabel() (string, bool) {
-	v, ok := p.Labels[pkg.PodAddressPoolIDLabel]
-	if ok {
-		val := strings.Clone(v)
-		return val, true
-	}
-	return "", false
-}
-
-func (p PodEvent) GetFixedTagAnnotation() (string, bool) {
-	if v, ok := p.Annotations[pkg.PodAddressFixedTagAnnotationKey]; ok {
-		return v, true
-	}
-	return "", false
-}
-
-func (p PodEvent) GetFixedTagLabel() (string, bool) {
-	v, ok := p.Labels[pkg.PodFixedTagLabel]
-	if ok {
-		val := strings.Clone(v)
-		return val, true
-	}
-	return "", false
-}
-
-func (p PodEvent) GetFixedTagValueAnnotation() (string, bool) {
-	if v, ok := p.Annotations[pkg.PodAddressFixedTagValueAnnotationKey]; ok {
-		return v, true
-	}
-	return "", false
-}
-
-func (p PodEvent) GetFixedTagValueLabel() (string, bool) {
-	v, ok := p.Labels[pkg.PodFixedTagValueLabel]
-	if ok {
-		val := strings.Clone(v)
-		return val, true
-	}
-	return "", false
-}
-
 func (p PodEvent) GetPublicIPLabel() (string, bool) {
 	if v, ok := p.Labels[pkg.PodPublicIPLabel]; ok {
 		return v, true
@@ -102,5 +57,9 @@ func NewPodEvent(key string, pod v1.Pod) PodEvent {
 		HostIP:          pod.Status.HostIP,
 		ResourceVersion: pod.ResourceVersion,
 	}
+	if owner := metav1.GetControllerOf(&pod); owner != nil {
+		podEvent.OwnerKind = owner.Kind
+		podEvent.OwnerName = owner.Name
+	}
 	return podEvent
 }
@@ -0,0 +1,124 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg/aws"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Reconcile compares the pods with the EC2 associations described in batch calls and returns the keys of the pods
+// which need changes, including pods which are gone but still have an address. Pods whose labels are in sync but
+// whose address is not are marked as drifted, so they are processed even though hasChange returns false. Pods with an
+// address which are not in the cache are only gone if the API does not find them either, the controller may not watch them.
+func (h *Handler) Reconcile(ctx context.Context, pods []*v1.Pod) ([]string, error) {
+	associations, err := h.eniClient.DescribeAssociations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("describe associations: %w", err)
+	}
+
+	var keys []string
+	seen := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		key, err := cache.MetaNamespaceKeyFunc(pod)
+		if err != nil {
+			return nil, fmt.Errorf("meta namespace key func: %w", err)
+		}
+		seen[key] = true
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		event := NewPodEvent(key, *pod)
+		if h.hasChange(event) {
+			keys = append(keys, key)
+			continue
+		}
+		if reason := drift(event, associations); reason != "" {
+			h.logger.Info(fmt.Sprintf("pod %s drifted: %s", key, reason))
+			h.markDrifted(key)
+			keys = append(keys, key)
+		}
+	}
+	for key := range associations.PodAddresses {
+		if seen[key] {
+			continue
+		}
+		gone, err := h.podGone(ctx, key)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("check if pod %s with an address is gone: %v", key, err))
+			continue
+		}
+		if !gone {
+			h.logger.Debug(fmt.Sprintf("pod %s with an address is not watched, skipping", key))
+			continue
+		}
+		h.logger.Info(fmt.Sprintf("pod %s is gone but still has an address", key))
+		keys = append(keys, key)
+	}
+	h.logger.Info(fmt.Sprintf("reconciled %d pods with %d addresses, %d need changes", len(pods), len(associations.PodAddresses), len(keys)))
+	return keys, nil
+}
+
+// podGone returns whether the pod of the key does not exist anymore
+func (h *Handler) podGone(ctx context.Context, key string) (bool, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return false, fmt.Errorf("split key %s: %w", key, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.callTimeout)
+	defer cancel()
+	if _, err := h.coreClient.Pods(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// drift returns why the address of a pod whose labels are in sync with its annotations is not as expected, empty if it is
+func drift(event PodEvent, associations aws.Associations) string {
+	addr, hasAddress := associations.PodAddresses[event.Key]
+	if _, ok := event.GetPECTypeAnnotation(); !ok {
+		if hasAddress {
+			return fmt.Sprintf("address %s without EIP annotation", addr.PublicIP)
+		}
+		return ""
+	}
+	publicIP, _ := event.GetPublicIPLabel()
+	switch {
+	case !hasAddress:
+		return "no address"
+	case addr.PublicIP != publicIP:
+		return fmt.Sprintf("address %s does not match public IP label %s", addr.PublicIP, publicIP)
+	case addr.PrivateIP != event.IP:
+		return fmt.Sprintf("address %s is associated to %q instead of %s", addr.PublicIP, addr.PrivateIP, event.IP)
+	}
+	// private IPs of prefixes are not listed on the network interfaces
+	if associated, ok := associations.PublicIPs[event.IP]; ok && associated != addr.PublicIP {
+		return fmt.Sprintf("private IP %s has address %s associated instead of %s", event.IP, associated, addr.PublicIP)
+	}
+	return ""
+}
+
+func (h *Handler) markDrifted(key string) {
+	h.driftedLock.Lock()
+	defer h.driftedLock.Unlock()
+	h.drifted[key] = struct{}{}
+}
+
+// takeDrifted returns whether the pod was marked as drifted and removes the mark
+func (h *Handler) takeDrifted(key string) bool {
+	h.driftedLock.Lock()
+	defer h.driftedLock.Unlock()
+	_, ok := h.drifted[key]
+	delete(h.drifted, key)
+	return ok
+}
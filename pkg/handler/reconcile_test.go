@@ -0,0 +1,98 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+	"github.com/aws-samples/aws-pod-eip-controller/pkg/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrift(t *testing.T) {
+	annotated := PodEvent{
+		Key:         "default/test",
+		IP:          "10.0.0.1",
+		Annotations: map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto},
+		Labels:      map[string]string{pkg.PodEIPAnnotationKeyLabel: pkg.PodEIPAnnotationValueAuto, pkg.PodPublicIPLabel: "1.1.1.1"},
+	}
+	associations := func(addr *aws.PodAddress, publicIPs map[string]string) aws.Associations {
+		associations := aws.Associations{PodAddresses: map[string]aws.PodAddress{}, PublicIPs: publicIPs}
+		if addr != nil {
+			associations.PodAddresses["default/test"] = *addr
+		}
+		return associations
+	}
+	inSync := aws.PodAddress{AllocationID: "eipalloc-1", PublicIP: "1.1.1.1", PrivateIP: "10.0.0.1", PECType: pkg.PodEIPAnnotationValueAuto}
+
+	for name, tc := range map[string]struct {
+		event        PodEvent
+		associations aws.Associations
+		drifted      bool
+	}{
+		"given pod without annotation when it has no address then it has not drifted": {
+			event:        PodEvent{Key: "default/test", IP: "10.0.0.1"},
+			associations: associations(nil, nil),
+		},
+		"given pod without annotation when it still has an address then it has drifted": {
+			event:        PodEvent{Key: "default/test", IP: "10.0.0.1"},
+			associations: associations(&inSync, nil),
+			drifted:      true,
+		},
+		"given annotated pod when it has no address then it has drifted": {
+			event:        annotated,
+			associations: associations(nil, nil),
+			drifted:      true,
+		},
+		"given annotated pod when the address does not match the public IP label then it has drifted": {
+			event:        annotated,
+			associations: associations(&aws.PodAddress{AllocationID: "eipalloc-2", PublicIP: "2.2.2.2", PrivateIP: "10.0.0.1"}, nil),
+			drifted:      true,
+		},
+		"given annotated pod when the address is not associated then it has drifted": {
+			event:        annotated,
+			associations: associations(&aws.PodAddress{AllocationID: "eipalloc-1", PublicIP: "1.1.1.1"}, nil),
+			drifted:      true,
+		},
+		"given annotated pod when the address is associated to another private IP then it has drifted": {
+			event:        annotated,
+			associations: associations(&aws.PodAddress{AllocationID: "eipalloc-1", PublicIP: "1.1.1.1", PrivateIP: "10.0.0.2"}, nil),
+			drifted:      true,
+		},
+		"given annotated pod when another address is associated to its private IP then it has drifted": {
+			event:        annotated,
+			associations: associations(&inSync, map[string]string{"10.0.0.1": "3.3.3.3"}),
+			drifted:      true,
+		},
+		"given annotated pod when its private IP is not listed on the network interfaces then it has not drifted": {
+			event:        annotated,
+			associations: associations(&inSync, map[string]string{}),
+		},
+		"given annotated pod when its address is associated to its private IP then it has not drifted": {
+			event:        annotated,
+			associations: associations(&inSync, map[string]string{"10.0.0.1": "1.1.1.1"}),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reason := drift(tc.event, tc.associations)
+			if tc.drifted {
+				assert.NotEmpty(t, reason)
+			} else {
+				assert.Empty(t, reason)
+			}
+		})
+	}
+}
+
+func TestHandler_takeDrifted(t *testing.T) {
+	t.Run("given drifted pod when the mark is taken then it is removed", func(t *testing.T) {
+		h := &Handler{drifted: map[string]struct{}{}}
+		h.markDrifted("default/test")
+
+		assert.True(t, h.takeDrifted("default/test"))
+		assert.False(t, h.takeDrifted("default/test"))
+		assert.False(t, h.takeDrifted("default/other"))
+	})
+}
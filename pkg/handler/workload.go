@@ -0,0 +1,108 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg/aws"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+type WorkloadClient interface {
+	DescribeWorkloadPools(context.Context) (map[aws.Workload]int, error)
+	ReleaseWorkloadAddresses(ctx context.Context, w aws.Workload, keep int) (int, error)
+}
+
+// WorkloadCollector releases the addresses of workload pools whose workload was scaled down or deleted
+type WorkloadCollector struct {
+	logger         *slog.Logger
+	appsClient     appsv1.AppsV1Interface
+	workloadClient WorkloadClient
+	// callTimeout is the timeout of every Kubernetes API call
+	callTimeout time.Duration
+}
+
+func NewWorkloadCollector(logger *slog.Logger, appsClient appsv1.AppsV1Interface, workloadClient WorkloadClient, callTimeout time.Duration) *WorkloadCollector {
+	return &WorkloadCollector{
+		logger:         logger.With("component", "workload-collector"),
+		appsClient:     appsClient,
+		workloadClient: workloadClient,
+		callTimeout:    callTimeout,
+	}
+}
+
+// Collect releases the addresses of every workload pool above the replicas of its workload, all of them if the
+// workload is gone
+func (w *WorkloadCollector) Collect(ctx context.Context) {
+	pools, err := w.workloadClient.DescribeWorkloadPools(ctx)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("describe workload pools: %v", err))
+		return
+	}
+	for workload, size := range pools {
+		replicas, err := w.replicas(ctx, workload)
+		if err != nil {
+			w.logger.Error(fmt.Sprintf("get workload %s: %v", workload, err))
+			continue
+		}
+		if size <= replicas {
+			continue
+		}
+		released, err := w.workloadClient.ReleaseWorkloadAddresses(ctx, workload, replicas)
+		if err != nil {
+			w.logger.Error(fmt.Sprintf("release workload %s addresses: %v", workload, err))
+			continue
+		}
+		if released > 0 {
+			w.logger.Info(fmt.Sprintf("released %d of %d addresses of workload %s pool with %d replicas", released, size, workload, replicas))
+		}
+	}
+}
+
+// replicas returns the desired replicas of the workload, 0 if it is gone or being deleted
+func (w *WorkloadCollector) replicas(ctx context.Context, workload aws.Workload) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.callTimeout)
+	defer cancel()
+
+	switch workload.Kind {
+	case "Deployment":
+		deployment, err := w.appsClient.Deployments(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return goneReplicas(err)
+		}
+		return desiredReplicas(deployment.ObjectMeta, deployment.Spec.Replicas), nil
+	case "StatefulSet":
+		statefulSet, err := w.appsClient.StatefulSets(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return goneReplicas(err)
+		}
+		return desiredReplicas(statefulSet.ObjectMeta, statefulSet.Spec.Replicas), nil
+	}
+	return 0, fmt.Errorf("unsupported workload kind %s", workload.Kind)
+}
+
+// goneReplicas returns no replicas if the workload was not found, the error otherwise
+func goneReplicas(err error) (int, error) {
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	}
+	return 0, err
+}
+
+// desiredReplicas returns the replicas of the workload spec, 1 by default and 0 if it is being deleted
+func desiredReplicas(meta metav1.ObjectMeta, replicas *int32) int {
+	if meta.DeletionTimestamp != nil {
+		return 0
+	}
+	if replicas == nil {
+		return 1
+	}
+	return int(*replicas)
+}
@@ -0,0 +1,44 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDesiredReplicas(t *testing.T) {
+	deleted := metav1.Now()
+	replicas := func(n int32) *int32 { return &n }
+
+	for name, tc := range map[string]struct {
+		meta     metav1.ObjectMeta
+		replicas *int32
+		want     int
+	}{
+		"given workload without replicas when the desired replicas are computed then it is 1": {
+			replicas: nil,
+			want:     1,
+		},
+		"given workload with replicas when the desired replicas are computed then it is the replicas": {
+			replicas: replicas(3),
+			want:     3,
+		},
+		"given workload scaled to zero when the desired replicas are computed then it is 0": {
+			replicas: replicas(0),
+			want:     0,
+		},
+		"given workload being deleted when the desired replicas are computed then it is 0": {
+			meta:     metav1.ObjectMeta{DeletionTimestamp: &deleted},
+			replicas: replicas(3),
+			want:     0,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, desiredReplicas(tc.meta, tc.replicas))
+		})
+	}
+}
@@ -10,9 +10,12 @@ import (
 	"time"
 
 	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+	"golang.org/x/time/rate"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -20,75 +23,261 @@ import (
 )
 
 type podWorker interface {
-	run(queue workqueue.RateLimitingInterface, indexer cache.KeyGetter)
+	run(ctx context.Context, queue workqueue.RateLimitingInterface, indexer cache.KeyGetter)
 }
 
 type PodController struct {
-	logger   *slog.Logger
-	queue    workqueue.RateLimitingInterface
-	informer cache.SharedIndexInformer
-	worker   podWorker
+	logger    *slog.Logger
+	queue     workqueue.RateLimitingInterface
+	informers namespacedInformers
+	// namespaceInformer watches the namespaces matching the namespace label selector, nil manages pods of all namespaces
+	namespaceInformer cache.SharedIndexInformer
+	worker            podWorker
+	handler           PodHandler
+	pending           *pendingPods
+	pendingPollPeriod time.Duration
+	validPECType      func(pecType string) bool
 }
 
 type PodControllerConfig struct {
-	Namespace    string
-	ResyncPeriod time.Duration
+	// Namespaces to watch with one informer each, empty watches all namespaces
+	Namespaces []string
+	// ExcludeNamespaces are excluded from the watch with a field selector
+	ExcludeNamespaces []string
+	ResyncPeriod      time.Duration
+	// PodLabelSelector and PodFieldSelector are passed to the pod list and watch calls
+	PodLabelSelector string
+	PodFieldSelector string
+	// NamespaceLabelSelector limits the managed pods to the namespaces with matching labels, empty manages all namespaces
+	NamespaceLabelSelector string
+	// PendingPollPeriod is how often pods waiting on an exhausted pool are retried, 0 disables polling
+	PendingPollPeriod time.Duration
+	// DeadLetterBaseDelay is the first retry delay of a key which exceeded queue retries, doubled on every attempt up to DeadLetterMaxDelay
+	DeadLetterBaseDelay time.Duration
+	DeadLetterMaxDelay  time.Duration
+	// QueueBaseDelay and QueueMaxDelay are the per-item exponential retry delays
+	QueueBaseDelay time.Duration
+	QueueMaxDelay  time.Duration
+	// QueueQPS and QueueBurst are the overall retry bucket, shared by all items
+	QueueQPS   float64
+	QueueBurst int
+	// MaxQueueRetries before an item moves to the dead-letter queue, InfiniteQueueRetries to never move it
+	MaxQueueRetries int
+	// FairQueueBy is FairQueueByNamespace, FairQueueByPriorityClass or FairQueueByNone
+	FairQueueBy string
+	// Workers is the maximum number of pods processed concurrently, 0 means unlimited
+	Workers int
+	// ShutdownTimeout is how long in-flight pods may take after shutdown before they are cancelled and requeued
+	ShutdownTimeout time.Duration
+	// ValidPECType returns whether the PEC type annotation value of a pod has a mode, pods of other values are ignored
+	ValidPECType func(pecType string) bool
 }
 
 func NewPodController(logger *slog.Logger, clientset *kubernetes.Clientset, handler PodHandler, config PodControllerConfig) (*PodController, error) {
+	pending := newPendingPods()
+	deadLetter := newDeadLetterQueue(config.DeadLetterBaseDelay, config.DeadLetterMaxDelay)
+	pkg.PublishMetric("dead_letter_queue", deadLetter.snapshot)
+	informers, err := newPodInformers(clientset, config)
+	if err != nil {
+		return nil, fmt.Errorf("new pod informers: %w", err)
+	}
 	controller := &PodController{
-		logger:   logger.With("component", "controller"),
-		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		informer: newPodInformer(clientset, config.Namespace, config.ResyncPeriod),
-		worker:   newWorker(logger, handler),
+		logger:            logger.With("component", "controller"),
+		queue:             newQueue(newQueueRateLimiter(config), config.FairQueueBy, informers),
+		informers:         informers,
+		worker:            newWorker(logger, handler, pending, deadLetter, config.MaxQueueRetries, config.Workers, config.ShutdownTimeout),
+		handler:           handler,
+		pending:           pending,
+		pendingPollPeriod: config.PendingPollPeriod,
+		validPECType:      config.ValidPECType,
 	}
 
-	if _, err := controller.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    controller.addFunc,
+	if err := controller.informers.addEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc:    controller.addEventFunc,
 		UpdateFunc: controller.updateFunc,
 		DeleteFunc: controller.deleteFunc,
 	}); err != nil {
 		return nil, fmt.Errorf("add event handlers: %w", err)
 	}
+
+	if config.NamespaceLabelSelector != "" {
+		controller.namespaceInformer = newNamespaceInformer(clientset, config.NamespaceLabelSelector, config.ResyncPeriod)
+		if _, err := controller.namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    controller.namespaceAddFunc,
+			DeleteFunc: controller.namespaceDeleteFunc,
+		}); err != nil {
+			return nil, fmt.Errorf("add namespace event handlers: %w", err)
+		}
+	}
 	return controller, nil
 }
 
-func newPodInformer(clientset *kubernetes.Clientset, namespace string, resyncPeriod time.Duration) cache.SharedIndexInformer {
+// newQueueRateLimiter returns the configured equivalent of workqueue.DefaultControllerRateLimiter
+func newQueueRateLimiter(config PodControllerConfig) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(config.QueueBaseDelay, config.QueueMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(config.QueueQPS), config.QueueBurst)},
+	)
+}
+
+// newPodInformers returns an informer for each watched namespace, or a single informer watching all namespaces
+func newPodInformers(clientset *kubernetes.Clientset, config PodControllerConfig) (namespacedInformers, error) {
+	fieldSelector, err := podFieldSelector(config)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := config.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	informers := make(namespacedInformers, len(namespaces))
+	for _, namespace := range namespaces {
+		informer := newPodInformer(clientset, namespace, config.PodLabelSelector, fieldSelector, config.ResyncPeriod)
+		if err := informer.SetTransform(stripPod); err != nil {
+			return nil, fmt.Errorf("set namespace %q pod transform: %w", namespace, err)
+		}
+		informers[namespace] = informer
+	}
+	return informers, nil
+}
+
+// podFieldSelector returns the pod field selector which also excludes the excluded namespaces
+func podFieldSelector(config PodControllerConfig) (string, error) {
+	selector, err := fields.ParseSelector(config.PodFieldSelector)
+	if err != nil {
+		return "", fmt.Errorf("parse pod field selector: %w", err)
+	}
+	for _, namespace := range config.ExcludeNamespaces {
+		selector = fields.AndSelectors(selector, fields.OneTermNotEqualSelector("metadata.namespace", namespace))
+	}
+	return selector.String(), nil
+}
+
+func newPodInformer(clientset *kubernetes.Clientset, namespace, labelSelector, fieldSelector string, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	selectPods := func(options *metav1.ListOptions) {
+		options.LabelSelector = labelSelector
+		options.FieldSelector = fieldSelector
+	}
 	return cache.NewSharedIndexInformer(
 		&cache.ListWatch{
-			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{})
+			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				selectPods(&options)
+				return clientset.CoreV1().Pods(namespace).List(ctx, options)
 			},
-			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return clientset.CoreV1().Pods(namespace).Watch(context.Background(), metav1.ListOptions{})
+			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				selectPods(&options)
+				return clientset.CoreV1().Pods(namespace).Watch(ctx, options)
 			},
 		},
 		&v1.Pod{},
 		resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+}
+
+func newNamespaceInformer(clientset *kubernetes.Clientset, labelSelector string, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = labelSelector
+				return clientset.CoreV1().Namespaces().List(ctx, options)
+			},
+			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = labelSelector
+				return clientset.CoreV1().Namespaces().Watch(ctx, options)
+			},
+		},
+		&v1.Namespace{},
+		resyncPeriod,
 		cache.Indexers{},
 	)
 }
 
-func (c *PodController) Run(stopCh <-chan struct{}) {
+// Run runs the controller until ctx is done, then waits for the in-flight pods up to the shutdown timeout
+func (c *PodController) Run(ctx context.Context) {
 	c.logger.Info("starting controller")
+	// namespaces have to be synced before pod events are filtered by namespace
+	if c.namespaceInformer != nil {
+		go c.namespaceInformer.RunWithContext(ctx)
+		c.logger.Info("waiting for namespace cache sync")
+		if !cache.WaitForCacheSync(ctx.Done(), c.namespaceInformer.HasSynced) {
+			c.logger.Error("failed to sync namespaces")
+			return
+		}
+	}
 	go func() {
-		c.informer.Run(stopCh)
+		c.informers.run(ctx)
 		c.logger.Info("informer stopped")
 		c.queue.ShutDown()
 		c.logger.Info("queue shut down")
 	}()
 
 	c.logger.Info("waiting for cache sync")
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), c.informers.hasSynced) {
 		c.logger.Error("failed to sync")
 		return
 	}
 	c.logger.Info("cache synced")
+	c.reconcile(ctx)
+	if c.pendingPollPeriod > 0 {
+		go wait.Until(c.pollPending, c.pendingPollPeriod, ctx.Done())
+	}
 	c.logger.Info("starting controller worker")
-	c.worker.run(c.queue, c.informer.GetIndexer())
+	c.worker.run(ctx, c.queue, c.informers)
 	c.logger.Info("controller worker stopped")
 }
 
+// WakePending adds the pod waiting the longest on the pool back to the queue, it is called when an address is returned to the pool
+func (c *PodController) WakePending(pool string) {
+	if key, ok := c.pending.next(pool); ok {
+		c.logger.Debug(fmt.Sprintf("address returned to %s pool, pending item %s added to queue", pool, key))
+		c.queue.Add(key)
+	}
+}
+
+// pollPending adds the pod waiting the longest on each pool back to the queue, so addresses added to a pool outside the controller are picked up
+func (c *PodController) pollPending() {
+	keys := c.pending.heads()
+	if len(keys) == 0 {
+		return
+	}
+	c.logger.Debug(fmt.Sprintf("polling %d pools for %d pending items", len(keys), c.pending.len()))
+	for _, key := range keys {
+		c.queue.Add(key)
+	}
+}
+
+// reconcile adds the pods which need changes after cache sync to the queue, or all pods if they could not be reconciled
+func (c *PodController) reconcile(ctx context.Context) {
+	pods := c.informers.list()
+	keys, err := c.handler.Reconcile(ctx, pods)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("reconcile %d pods, adding all to queue: %v", len(pods), err))
+		for _, p := range pods {
+			c.addFunc(p)
+		}
+		return
+	}
+	var added int
+	for _, key := range keys {
+		if !c.managedNamespace(key) {
+			c.logger.Debug(fmt.Sprintf("skipping reconciled %s namespace is not managed", key))
+			continue
+		}
+		c.queue.Add(key)
+		added++
+	}
+	c.logger.Info(fmt.Sprintf("reconciled %d pods, %d added to queue", len(pods), added))
+}
+
+// addEventFunc skips the pods of the initial list, they are added to the queue by reconcile after cache sync
+func (c *PodController) addEventFunc(obj interface{}, isInInitialList bool) {
+	if isInInitialList {
+		return
+	}
+	c.addFunc(obj)
+}
+
 func (c *PodController) addFunc(obj interface{}) {
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -96,6 +285,11 @@ func (c *PodController) addFunc(obj interface{}) {
 		return
 	}
 
+	if !c.managedNamespace(key) {
+		c.logger.Debug(fmt.Sprintf("skipping add event %s namespace is not managed", key))
+		return
+	}
+
 	// pod does not have annotation or IP is missing
 	if p := c.toPod(key, obj); !p.hasEIPAnnotation || p.ip == "" {
 		c.logger.Debug(fmt.Sprintf("skipping add event %s", key))
@@ -113,11 +307,18 @@ func (c *PodController) updateFunc(oldObj, newObj interface{}) {
 		return
 	}
 
-	if c.toPod(key, newObj).ip == "" {
-		c.logger.Debug(fmt.Sprintf("skipping update event %s pod does not have ip", key))
+	if !c.managedNamespace(key) {
+		c.logger.Debug(fmt.Sprintf("skipping update event %s namespace is not managed", key))
+		return
+	}
+
+	if reason := updateSkipReason(oldObj.(*v1.Pod), newObj.(*v1.Pod)); reason != "" {
+		pkg.AddMetric("update_events_skipped_"+reason, 1)
+		c.logger.Debug(fmt.Sprintf("skipping update event %s: %s", key, reason))
 		return
 	}
 
+	pkg.AddMetric("update_events_queued", 1)
 	c.logger.Debug(fmt.Sprintf("update event %s added to queue", key))
 	c.queue.Add(key)
 }
@@ -134,6 +335,44 @@ func (c *PodController) deleteFunc(obj interface{}) {
 	c.queue.Add(key)
 }
 
+// namespaceAddFunc adds the pods of a namespace which started to match the namespace label selector
+func (c *PodController) namespaceAddFunc(obj interface{}) {
+	namespace := obj.(*v1.Namespace).Name
+	pods, err := c.informers.byNamespace(namespace)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("handle namespace add event: list %s pods: %v", namespace, err))
+		return
+	}
+	c.logger.Debug(fmt.Sprintf("namespace %s is managed, adding %d pods", namespace, len(pods)))
+	for _, p := range pods {
+		c.addFunc(p)
+	}
+}
+
+// namespaceDeleteFunc logs namespaces which stopped matching the namespace label selector, addresses of their pods
+// are kept until the pods are deleted
+func (c *PodController) namespaceDeleteFunc(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("handle namespace delete event: meta namespace key func: %v", err))
+		return
+	}
+	c.logger.Debug(fmt.Sprintf("namespace %s is no longer managed", key))
+}
+
+// managedNamespace returns whether the namespace of the pod key matches the namespace label selector
+func (c *PodController) managedNamespace(key string) bool {
+	if c.namespaceInformer == nil {
+		return true
+	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return false
+	}
+	_, exists, err := c.namespaceInformer.GetStore().GetByKey(namespace)
+	return err == nil && exists
+}
+
 type pod struct {
 	hasEIPAnnotation bool
 	ip               string
@@ -147,7 +386,7 @@ func (c *PodController) toPod(key string, obj interface{}) pod {
 
 	v1Pod := *obj.(*v1.Pod)
 	var hasEIPAnnotation bool
-	if v, ok := v1Pod.Annotations[pkg.PodEIPAnnotationKey]; ok && pkg.ValidPECType(v) {
+	if v, ok := v1Pod.Annotations[pkg.PodEIPAnnotationKey]; ok && c.validPECType(v) {
 		hasEIPAnnotation = true
 	}
 
@@ -4,12 +4,18 @@
 package k8s
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/aws-samples/aws-pod-eip-controller/pkg"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -130,14 +136,25 @@ func TestPodController_addFunc(t *testing.T) {
 func TestPodController_addUpdateEvent(t *testing.T) {
 	annotations := map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto}
 
-	t.Run("given pod when it has ip and no eip annotation then it is added to the queue", func(t *testing.T) {
+	t.Run("given pod when it has ip and no eip annotation or controller labels then it is not added to the queue", func(t *testing.T) {
 		controller := newTestController(5, 500)
 		pod := getPod("10.0.0.1", nil)
 		controller.updateFunc(pod, pod)
 
+		assert.Equal(t, 0, controller.queue.Len())
+	})
+
+	t.Run("given pod when eip annotation is removed then it is added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		oldPod := getPod("10.0.0.1", annotations).(*v1.Pod)
+		oldPod.Labels = map[string]string{pkg.PodPublicIPLabel: "1.1.1.1"}
+		newPod := oldPod.DeepCopy()
+		newPod.ResourceVersion = "2"
+		newPod.Annotations = nil
+		controller.updateFunc(oldPod, newPod)
+
 		assert.Equal(t, 1, controller.queue.Len())
 		assert.Equal(t, "default/test", getQueueItem(controller.queue))
-		assert.Equal(t, 0, controller.queue.Len())
 	})
 
 	t.Run("given pod when it has ip and eip annotation then it is added to the queue", func(t *testing.T) {
@@ -193,10 +210,160 @@ func TestPodController_addDeleteEvent(t *testing.T) {
 	})
 }
 
+func TestPodController_namespaceLabelSelector(t *testing.T) {
+	annotations := map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto}
+
+	t.Run("given namespace not matching selector when pod is added or updated then it is not added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		controller.namespaceInformer = newTestInformer(&v1.Namespace{})
+		pod := getPod("10.0.0.1", annotations)
+		controller.addFunc(pod)
+		controller.updateFunc(pod, pod)
+
+		assert.Equal(t, 0, controller.queue.Len())
+	})
+
+	t.Run("given namespace not matching selector when pod is deleted then it is added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		controller.namespaceInformer = newTestInformer(&v1.Namespace{})
+		controller.deleteFunc(getPod("10.0.0.1", annotations))
+
+		assert.Equal(t, 1, controller.queue.Len())
+	})
+
+	t.Run("given namespace matching selector when pod is added then it is added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		controller.namespaceInformer = newTestInformer(&v1.Namespace{})
+		_ = controller.namespaceInformer.GetStore().Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+		controller.addFunc(getPod("10.0.0.1", annotations))
+
+		assert.Equal(t, 1, controller.queue.Len())
+	})
+
+	t.Run("given pods when namespace starts matching selector then its pods with eip annotation are added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		informer := newTestInformer(&v1.Pod{})
+		controller.informers = namespacedInformers{"": informer}
+		controller.namespaceInformer = newTestInformer(&v1.Namespace{})
+		_ = informer.GetStore().Add(addPodName(getPod("10.0.0.1", annotations), "test1"))
+		_ = informer.GetStore().Add(addPodName(getPod("10.0.0.2", nil), "test2"))
+		namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+		_ = controller.namespaceInformer.GetStore().Add(namespace)
+		controller.namespaceAddFunc(namespace)
+
+		assert.Equal(t, 1, controller.queue.Len())
+		assert.Equal(t, "default/test1", getQueueItem(controller.queue))
+	})
+}
+
+func TestPodController_reconcile(t *testing.T) {
+	annotations := map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto}
+
+	t.Run("given pod of initial list when it is added then it is not added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		controller.addEventFunc(getPod("10.0.0.1", annotations), true)
+
+		assert.Equal(t, 0, controller.queue.Len())
+	})
+
+	t.Run("given pods when they are reconciled then only pods which need changes are added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		informer := newTestInformer(&v1.Pod{})
+		controller.informers = namespacedInformers{"": informer}
+		_ = informer.GetStore().Add(addPodName(getPod("10.0.0.1", annotations), "test1"))
+		_ = informer.GetStore().Add(addPodName(getPod("10.0.0.2", annotations), "test2"))
+		handler := new(HandlerMock)
+		handler.On("Reconcile", mock.Anything, mock.Anything).Return([]string{"default/test2", "default/gone"}, nil).Once()
+		controller.handler = handler
+		controller.reconcile(context.Background())
+
+		mock.AssertExpectationsForObjects(t, handler)
+		assert.Len(t, handler.Calls[0].Arguments.Get(1), 2)
+		assert.Equal(t, 2, controller.queue.Len())
+		assert.Equal(t, "default/test2", getQueueItem(controller.queue))
+		assert.Equal(t, "default/gone", getQueueItem(controller.queue))
+	})
+
+	t.Run("given namespace label selector when pods are reconciled then pods of unmanaged namespaces are not added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		informer := newTestInformer(&v1.Pod{})
+		controller.informers = namespacedInformers{"": informer}
+		controller.namespaceInformer = newTestInformer(&v1.Namespace{})
+		_ = controller.namespaceInformer.GetStore().Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "managed"}})
+		handler := new(HandlerMock)
+		handler.On("Reconcile", mock.Anything, mock.Anything).Return([]string{"managed/test1", "default/test2"}, nil).Once()
+		controller.handler = handler
+		controller.reconcile(context.Background())
+
+		mock.AssertExpectationsForObjects(t, handler)
+		assert.Equal(t, 1, controller.queue.Len())
+		assert.Equal(t, "managed/test1", getQueueItem(controller.queue))
+	})
+
+	t.Run("given pods when reconcile fails then all pods with eip annotation are added to the queue", func(t *testing.T) {
+		controller := newTestController(5, 500)
+		informer := newTestInformer(&v1.Pod{})
+		controller.informers = namespacedInformers{"": informer}
+		_ = informer.GetStore().Add(addPodName(getPod("10.0.0.1", annotations), "test1"))
+		_ = informer.GetStore().Add(addPodName(getPod("10.0.0.2", nil), "test2"))
+		handler := new(HandlerMock)
+		handler.On("Reconcile", mock.Anything, mock.Anything).Return([]string(nil), errors.New("test describe failure")).Once()
+		controller.handler = handler
+		controller.reconcile(context.Background())
+
+		mock.AssertExpectationsForObjects(t, handler)
+		assert.Equal(t, 1, controller.queue.Len())
+		assert.Equal(t, "default/test1", getQueueItem(controller.queue))
+	})
+}
+
+func TestPodFieldSelector(t *testing.T) {
+	t.Run("given excluded namespaces when field selector is built then namespaces are excluded", func(t *testing.T) {
+		selector, err := podFieldSelector(PodControllerConfig{
+			PodFieldSelector:  "status.phase=Running",
+			ExcludeNamespaces: []string{"kube-system", "platform"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "status.phase=Running,metadata.namespace!=kube-system,metadata.namespace!=platform", selector)
+	})
+
+	t.Run("given invalid field selector when field selector is built then error is returned", func(t *testing.T) {
+		_, err := podFieldSelector(PodControllerConfig{PodFieldSelector: "status.phase"})
+		assert.Error(t, err)
+	})
+}
+
+func TestNewQueueRateLimiter(t *testing.T) {
+	t.Run("given queue config when item fails repeatedly then delay doubles up to max delay", func(t *testing.T) {
+		limiter := newQueueRateLimiter(PodControllerConfig{
+			QueueBaseDelay: 10 * time.Millisecond,
+			QueueMaxDelay:  30 * time.Millisecond,
+			QueueQPS:       1000,
+			QueueBurst:     1000,
+		})
+
+		assert.Equal(t, 10*time.Millisecond, limiter.When(testKey))
+		assert.Equal(t, 20*time.Millisecond, limiter.When(testKey))
+		assert.Equal(t, 30*time.Millisecond, limiter.When(testKey))
+		assert.Equal(t, 3, limiter.NumRequeues(testKey))
+
+		limiter.Forget(testKey)
+		assert.Equal(t, 10*time.Millisecond, limiter.When(testKey))
+	})
+}
+
 // --- helpers ---
 
 func newTestController(queueBaseMs, queueMaxDelayMs int) *PodController {
-	return &PodController{logger: noOpLogger, queue: newTestQueue(queueBaseMs, queueMaxDelayMs)}
+	return &PodController{logger: noOpLogger, queue: newTestQueue(queueBaseMs, queueMaxDelayMs), validPECType: validTestPECType}
+}
+
+func validTestPECType(pecType string) bool {
+	return pecType == pkg.PodEIPAnnotationValueAuto
+}
+
+func newTestInformer(objType runtime.Object) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(&cache.ListWatch{}, objType, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
 }
 
 func getQueueItem(queue workqueue.RateLimitingInterface) string {
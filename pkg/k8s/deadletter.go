@@ -0,0 +1,84 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"sync"
+	"time"
+)
+
+// deadLetterQueue keeps keys which exceeded queue retries, they are retried on a slow exponential schedule until they succeed
+type deadLetterQueue struct {
+	lock      sync.Mutex
+	items     map[string]deadLetterItem
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+type deadLetterItem struct {
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	Since     time.Time `json:"since"`
+	NextRetry time.Time `json:"nextRetry"`
+}
+
+func newDeadLetterQueue(baseDelay, maxDelay time.Duration) *deadLetterQueue {
+	return &deadLetterQueue{
+		items:     make(map[string]deadLetterItem),
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+// add records the failed attempt and returns the item with the delay after which the key should be retried
+func (d *deadLetterQueue) add(key string, err error) (deadLetterItem, time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	item, ok := d.items[key]
+	if !ok {
+		item.Since = now
+	}
+	item.Attempts++
+	item.Error = err.Error()
+
+	delay := d.baseDelay
+	for i := 1; i < item.Attempts && delay < d.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.maxDelay {
+		delay = d.maxDelay
+	}
+	item.NextRetry = now.Add(delay)
+	d.items[key] = item
+	return item, delay
+}
+
+// remove deletes the key and returns true if the key was in the dead-letter queue
+func (d *deadLetterQueue) remove(key string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_, ok := d.items[key]
+	delete(d.items, key)
+	return ok
+}
+
+func (d *deadLetterQueue) contains(key string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_, ok := d.items[key]
+	return ok
+}
+
+// snapshot returns a copy of the dead-letter queue content
+func (d *deadLetterQueue) snapshot() any {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	out := make(map[string]deadLetterItem, len(d.items))
+	for k, v := range d.items {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	t.Run("given dead-letter queue when key fails repeatedly then delay doubles up to max delay", func(t *testing.T) {
+		deadLetter := newDeadLetterQueue(time.Minute, 5*time.Minute)
+
+		var delays []time.Duration
+		for i := 0; i < 5; i++ {
+			_, delay := deadLetter.add(testKey, errors.New("test failure"))
+			delays = append(delays, delay)
+		}
+
+		assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}, delays)
+	})
+
+	t.Run("given dead-letter queue when key fails then attempts and error are recorded", func(t *testing.T) {
+		deadLetter := newDeadLetterQueue(time.Minute, time.Hour)
+		first, _ := deadLetter.add(testKey, errors.New("first failure"))
+		second, _ := deadLetter.add(testKey, errors.New("second failure"))
+
+		assert.Equal(t, 2, second.Attempts)
+		assert.Equal(t, "second failure", second.Error)
+		assert.Equal(t, first.Since, second.Since)
+		assert.Len(t, deadLetter.snapshot(), 1)
+	})
+
+	t.Run("given dead-letter item when it is removed then it is not in the queue", func(t *testing.T) {
+		deadLetter := newDeadLetterQueue(time.Minute, time.Hour)
+		deadLetter.add(testKey, errors.New("test failure"))
+
+		assert.True(t, deadLetter.remove(testKey))
+		assert.False(t, deadLetter.contains(testKey))
+		assert.False(t, deadLetter.remove(testKey))
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	FairQueueByNone          = "none"
+	FairQueueByNamespace     = "namespace"
+	FairQueueByPriorityClass = "priority-class"
+)
+
+// fairQueue is the workqueue storage which round-robins between fairness keys when items are popped, so one namespace
+// with many pods can't delay the pods of other namespaces. Items with the same fairness key are popped in FIFO order.
+// Workqueue calls all functions while holding its lock.
+type fairQueue struct {
+	fairnessKey func(item interface{}) string
+	queues      map[string][]interface{}
+	// order holds the fairness keys which have items, next is the index of the key to pop from
+	order  []string
+	next   int
+	length int
+}
+
+func newFairQueue(fairnessKey func(item interface{}) string) *fairQueue {
+	return &fairQueue{
+		fairnessKey: fairnessKey,
+		queues:      make(map[string][]interface{}),
+	}
+}
+
+func (q *fairQueue) Touch(item interface{}) {}
+
+func (q *fairQueue) Push(item interface{}) {
+	key := q.fairnessKey(item)
+	if len(q.queues[key]) == 0 {
+		q.order = append(q.order, key)
+	}
+	q.queues[key] = append(q.queues[key], item)
+	q.length++
+}
+
+func (q *fairQueue) Len() int {
+	return q.length
+}
+
+func (q *fairQueue) Pop() interface{} {
+	key := q.order[q.next]
+	items := q.queues[key]
+	item := items[0]
+	items[0] = nil
+	q.length--
+	if len(items) == 1 {
+		delete(q.queues, key)
+		q.order = append(q.order[:q.next], q.order[q.next+1:]...)
+	} else {
+		q.queues[key] = items[1:]
+		q.next++
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+	return item
+}
+
+// newQueue returns the rate limiting queue with fair queuing by namespace or pod priority class
+func newQueue(rateLimiter workqueue.RateLimiter, fairQueueBy string, indexer cache.KeyGetter) workqueue.RateLimitingInterface {
+	var fairnessKey func(item interface{}) string
+	switch fairQueueBy {
+	case FairQueueByNamespace:
+		fairnessKey = namespaceFairnessKey
+	case FairQueueByPriorityClass:
+		fairnessKey = priorityClassFairnessKey(indexer)
+	default:
+		return workqueue.NewRateLimitingQueue(rateLimiter)
+	}
+	return workqueue.NewRateLimitingQueueWithConfig(rateLimiter, workqueue.RateLimitingQueueConfig{
+		DelayingQueue: workqueue.NewDelayingQueueWithConfig(workqueue.DelayingQueueConfig{
+			Queue: workqueue.NewWithConfig(workqueue.QueueConfig{
+				Queue: newFairQueue(fairnessKey),
+			}),
+		}),
+	})
+}
+
+func namespaceFairnessKey(item interface{}) string {
+	namespace, _, _ := cache.SplitMetaNamespaceKey(item.(string))
+	return namespace
+}
+
+// priorityClassFairnessKey returns the pod priority class, deleted pods share the empty priority class
+func priorityClassFairnessKey(indexer cache.KeyGetter) func(item interface{}) string {
+	return func(item interface{}) string {
+		obj, exists, err := indexer.GetByKey(item.(string))
+		if err != nil || !exists {
+			return ""
+		}
+		return obj.(*v1.Pod).Spec.PriorityClassName
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestFairQueue(t *testing.T) {
+	t.Run("given burst in one namespace when items are popped then namespaces are round-robined", func(t *testing.T) {
+		queue := newQueue(workqueue.DefaultControllerRateLimiter(), FairQueueByNamespace, nil)
+		defer queue.ShutDown()
+		for _, key := range []string{"burst/pod1", "burst/pod2", "burst/pod3", "small/pod1", "other/pod1", "small/pod2"} {
+			queue.Add(key)
+		}
+
+		assert.Equal(t, []string{"burst/pod1", "small/pod1", "other/pod1", "burst/pod2", "small/pod2", "burst/pod3"}, popAll(queue))
+	})
+
+	t.Run("given items added while popping when items are popped then new namespace is served in the next round", func(t *testing.T) {
+		queue := newQueue(workqueue.DefaultControllerRateLimiter(), FairQueueByNamespace, nil)
+		defer queue.ShutDown()
+		queue.Add("burst/pod1")
+		queue.Add("burst/pod2")
+		queue.Add("burst/pod3")
+
+		first, _ := queue.Get()
+		queue.Done(first)
+		queue.Add("small/pod1")
+
+		assert.Equal(t, "burst/pod1", first)
+		assert.Equal(t, []string{"burst/pod2", "small/pod1", "burst/pod3"}, popAll(queue))
+	})
+
+	t.Run("given fair queue by priority class when items are popped then priority classes are round-robined", func(t *testing.T) {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, p := range []struct{ name, priorityClass string }{{"low1", "low"}, {"low2", "low"}, {"high1", "high"}} {
+			_ = indexer.Add(&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: p.name, Namespace: "default"},
+				Spec:       v1.PodSpec{PriorityClassName: p.priorityClass},
+			})
+		}
+		queue := newQueue(workqueue.DefaultControllerRateLimiter(), FairQueueByPriorityClass, indexer)
+		defer queue.ShutDown()
+		for _, key := range []string{"default/low1", "default/low2", "default/high1", "default/deleted"} {
+			queue.Add(key)
+		}
+
+		assert.Equal(t, []string{"default/low1", "default/high1", "default/deleted", "default/low2"}, popAll(queue))
+	})
+
+	t.Run("given fair queue by none when items are popped then items are in FIFO order", func(t *testing.T) {
+		queue := newQueue(workqueue.DefaultControllerRateLimiter(), FairQueueByNone, nil)
+		defer queue.ShutDown()
+		for _, key := range []string{"burst/pod1", "burst/pod2", "small/pod1"} {
+			queue.Add(key)
+		}
+
+		assert.Equal(t, []string{"burst/pod1", "burst/pod2", "small/pod1"}, popAll(queue))
+	})
+}
+
+func popAll(queue workqueue.RateLimitingInterface) []string {
+	var keys []string
+	for queue.Len() > 0 {
+		item, _ := queue.Get()
+		keys = append(keys, item.(string))
+		queue.Done(item)
+	}
+	return keys
+}
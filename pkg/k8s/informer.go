@@ -0,0 +1,120 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespacedInformers are the pod informers by watched namespace, a single informer with the empty namespace watches
+// all namespaces. Lookups are routed to the informer of the key namespace.
+type namespacedInformers map[string]cache.SharedIndexInformer
+
+func (i namespacedInformers) addEventHandler(handler cache.ResourceEventHandler) error {
+	for namespace, informer := range i {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+	}
+	return nil
+}
+
+// run runs all informers until ctx is done
+func (i namespacedInformers) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, informer := range i {
+		wg.Add(1)
+		go func(informer cache.SharedIndexInformer) {
+			defer wg.Done()
+			informer.RunWithContext(ctx)
+		}(informer)
+	}
+	wg.Wait()
+}
+
+func (i namespacedInformers) hasSynced() bool {
+	for _, informer := range i {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// GetByKey returns the pod from the informer of the key namespace
+func (i namespacedInformers) GetByKey(key string) (interface{}, bool, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	informer, ok := i.informer(namespace)
+	if !ok {
+		return nil, false, nil
+	}
+	return informer.GetIndexer().GetByKey(key)
+}
+
+// byNamespace returns the cached pods of the namespace
+func (i namespacedInformers) byNamespace(namespace string) ([]interface{}, error) {
+	informer, ok := i.informer(namespace)
+	if !ok {
+		return nil, nil
+	}
+	return informer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+}
+
+// list returns the cached pods of all informers
+func (i namespacedInformers) list() []*v1.Pod {
+	var pods []*v1.Pod
+	for _, informer := range i {
+		for _, obj := range informer.GetStore().List() {
+			pods = append(pods, obj.(*v1.Pod))
+		}
+	}
+	return pods
+}
+
+func (i namespacedInformers) informer(namespace string) (cache.SharedIndexInformer, bool) {
+	if informer, ok := i[namespace]; ok {
+		return informer, true
+	}
+	informer, ok := i[""]
+	return informer, ok
+}
+
+// stripPod is the pod informer transform which keeps only the pod fields used by the controller and the handler, to
+// reduce the informer cache memory on large clusters. Fields used in the future have to be added here.
+func stripPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return obj, nil
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              pod.Name,
+			Namespace:         pod.Namespace,
+			UID:               pod.UID,
+			ResourceVersion:   pod.ResourceVersion,
+			Labels:            pod.Labels,
+			Annotations:       pod.Annotations,
+			OwnerReferences:   pod.OwnerReferences,
+			DeletionTimestamp: pod.DeletionTimestamp,
+		},
+		Spec: v1.PodSpec{
+			NodeName:          pod.Spec.NodeName,
+			PriorityClassName: pod.Spec.PriorityClassName,
+		},
+		Status: v1.PodStatus{
+			Phase:  pod.Status.Phase,
+			PodIP:  pod.Status.PodIP,
+			HostIP: pod.Status.HostIP,
+		},
+	}, nil
+}
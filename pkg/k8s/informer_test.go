@@ -0,0 +1,106 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNamespacedInformers(t *testing.T) {
+	tenant1, tenant2 := newTestInformer(&v1.Pod{}), newTestInformer(&v1.Pod{})
+	_ = tenant1.GetStore().Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "tenant1"}})
+	_ = tenant2.GetStore().Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "tenant2"}})
+	informers := namespacedInformers{"tenant1": tenant1, "tenant2": tenant2}
+
+	t.Run("given informer per namespace when pod is looked up then informer of its namespace is used", func(t *testing.T) {
+		_, exists, err := informers.GetByKey("tenant1/pod1")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		_, exists, _ = informers.GetByKey("tenant2/pod2")
+		assert.True(t, exists)
+		_, exists, _ = informers.GetByKey("tenant1/pod2")
+		assert.False(t, exists)
+	})
+
+	t.Run("given informer per namespace when pod of not watched namespace is looked up then it does not exist", func(t *testing.T) {
+		_, exists, err := informers.GetByKey("kube-system/pod1")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		pods, err := informers.byNamespace("kube-system")
+		assert.NoError(t, err)
+		assert.Empty(t, pods)
+	})
+
+	t.Run("given informer of all namespaces when pods are listed by namespace then pods of the namespace are returned", func(t *testing.T) {
+		all := newTestInformer(&v1.Pod{})
+		_ = all.GetStore().Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "tenant1"}})
+		_ = all.GetStore().Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "tenant2"}})
+
+		pods, err := namespacedInformers{"": all}.byNamespace("tenant2")
+		assert.NoError(t, err)
+		assert.Len(t, pods, 1)
+	})
+}
+
+func TestStripPod(t *testing.T) {
+	t.Run("given pod when it is stripped then only used fields are kept", func(t *testing.T) {
+		now := metav1.Now()
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test",
+				Namespace:         "default",
+				UID:               "uid",
+				ResourceVersion:   "1",
+				Labels:            map[string]string{"app": "test"},
+				Annotations:       map[string]string{"annotation": "value"},
+				OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "test"}},
+				DeletionTimestamp: &now,
+				ManagedFields:     []metav1.ManagedFieldsEntry{{Manager: "kubelet"}},
+			},
+			Spec: v1.PodSpec{
+				NodeName:          "node",
+				PriorityClassName: "high",
+				Containers:        []v1.Container{{Name: "test", Image: "test"}},
+			},
+			Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				PodIP:      "10.0.0.1",
+				HostIP:     "10.0.0.2",
+				Conditions: []v1.PodCondition{{Type: v1.PodReady}},
+			},
+		}
+
+		obj, err := stripPod(pod)
+		assert.NoError(t, err)
+		stripped := obj.(*v1.Pod)
+		assert.Equal(t, pod.Name, stripped.Name)
+		assert.Equal(t, pod.UID, stripped.UID)
+		assert.Equal(t, pod.ResourceVersion, stripped.ResourceVersion)
+		assert.Equal(t, pod.Labels, stripped.Labels)
+		assert.Equal(t, pod.Annotations, stripped.Annotations)
+		assert.Equal(t, pod.OwnerReferences, stripped.OwnerReferences)
+		assert.Equal(t, pod.DeletionTimestamp, stripped.DeletionTimestamp)
+		assert.Equal(t, "high", stripped.Spec.PriorityClassName)
+		assert.Equal(t, "node", stripped.Spec.NodeName)
+		assert.Equal(t, pod.Status.PodIP, stripped.Status.PodIP)
+		assert.Equal(t, pod.Status.HostIP, stripped.Status.HostIP)
+		assert.Equal(t, v1.PodRunning, stripped.Status.Phase)
+		assert.Empty(t, stripped.ManagedFields)
+		assert.Empty(t, stripped.Spec.Containers)
+		assert.Empty(t, stripped.Status.Conditions)
+	})
+
+	t.Run("given deleted object tombstone when it is stripped then it is not changed", func(t *testing.T) {
+		tombstone := cache.DeletedFinalStateUnknown{Key: "default/test"}
+		obj, err := stripPod(tombstone)
+		assert.NoError(t, err)
+		assert.Equal(t, tombstone, obj)
+	})
+}
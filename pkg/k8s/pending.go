@@ -0,0 +1,98 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"sync"
+)
+
+// pendingError is implemented by errors which mean the pod has to wait until an address in the pool becomes available
+type pendingError interface {
+	error
+	PendingPool() string
+}
+
+// pendingPods keeps pods waiting for an address per pool, in the order they started waiting
+type pendingPods struct {
+	lock  sync.Mutex
+	pools map[string][]string
+	keys  map[string]string
+}
+
+func newPendingPods() *pendingPods {
+	return &pendingPods{
+		pools: make(map[string][]string),
+		keys:  make(map[string]string),
+	}
+}
+
+// add marks the key as waiting on the pool, a key already waiting on the same pool keeps its position
+func (p *pendingPods) add(pool, key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if current, ok := p.keys[key]; ok {
+		if current == pool {
+			return
+		}
+		p.removeLocked(key)
+	}
+	p.keys[key] = pool
+	p.pools[pool] = append(p.pools[pool], key)
+}
+
+// remove stops tracking the key and returns the pool it was waiting on
+func (p *pendingPods) remove(key string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.removeLocked(key)
+}
+
+func (p *pendingPods) removeLocked(key string) (string, bool) {
+	pool, ok := p.keys[key]
+	if !ok {
+		return "", false
+	}
+	delete(p.keys, key)
+	keys := p.pools[pool]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(p.pools, pool)
+	} else {
+		p.pools[pool] = keys
+	}
+	return pool, true
+}
+
+// next returns the key waiting the longest on the pool, the key stays pending until it is removed
+func (p *pendingPods) next(pool string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	keys, ok := p.pools[pool]
+	if !ok {
+		return "", false
+	}
+	return keys[0], true
+}
+
+// heads returns the key waiting the longest on every pool
+func (p *pendingPods) heads() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	out := make([]string, 0, len(p.pools))
+	for _, keys := range p.pools {
+		out = append(out, keys[0])
+	}
+	return out
+}
+
+func (p *pendingPods) len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.keys)
+}
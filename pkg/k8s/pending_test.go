@@ -0,0 +1,69 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingPods(t *testing.T) {
+	t.Run("given pending pods when next is called then the pod waiting the longest is returned", func(t *testing.T) {
+		pending := newPendingPods()
+		pending.add("pool", "default/test1")
+		pending.add("pool", "default/test2")
+		// adding again keeps the position
+		pending.add("pool", "default/test1")
+
+		key, ok := pending.next("pool")
+		assert.True(t, ok)
+		assert.Equal(t, "default/test1", key)
+		assert.Equal(t, 2, pending.len())
+	})
+
+	t.Run("given pending pod when it is removed then the next pod is returned", func(t *testing.T) {
+		pending := newPendingPods()
+		pending.add("pool", "default/test1")
+		pending.add("pool", "default/test2")
+
+		pool, ok := pending.remove("default/test1")
+		assert.True(t, ok)
+		assert.Equal(t, "pool", pool)
+		key, _ := pending.next("pool")
+		assert.Equal(t, "default/test2", key)
+
+		pending.remove("default/test2")
+		_, ok = pending.next("pool")
+		assert.False(t, ok)
+		assert.Equal(t, 0, pending.len())
+	})
+
+	t.Run("given pending pod when it waits on another pool then it is moved", func(t *testing.T) {
+		pending := newPendingPods()
+		pending.add("pool1", "default/test1")
+		pending.add("pool2", "default/test1")
+
+		_, ok := pending.next("pool1")
+		assert.False(t, ok)
+		key, _ := pending.next("pool2")
+		assert.Equal(t, "default/test1", key)
+		assert.Equal(t, 1, pending.len())
+	})
+
+	t.Run("given pods pending on multiple pools when heads is called then the first pod of each pool is returned", func(t *testing.T) {
+		pending := newPendingPods()
+		pending.add("pool1", "default/test1")
+		pending.add("pool1", "default/test2")
+		pending.add("pool2", "default/test3")
+
+		assert.ElementsMatch(t, []string{"default/test1", "default/test3"}, pending.heads())
+	})
+
+	t.Run("given pod that is not pending when it is removed then nothing is returned", func(t *testing.T) {
+		pending := newPendingPods()
+		_, ok := pending.remove("default/test1")
+		assert.False(t, ok)
+	})
+}
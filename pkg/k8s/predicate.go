@@ -0,0 +1,79 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"strings"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+	v1 "k8s.io/api/core/v1"
+)
+
+// updateSkipReason returns why the pod update does not have to be processed, empty if it has to be processed.
+// Updates are processed when the pod has an IP and the EIP annotations, controller labels, IPs, phase or deletion
+// state changed. Pods with a tag value template are processed on any label change, the template may read any label.
+// Resyncs are processed only for pods with EIP annotations or controller labels.
+func updateSkipReason(oldPod, newPod *v1.Pod) string {
+	if newPod.Status.PodIP == "" {
+		return "no_ip"
+	}
+	if !managedPod(oldPod) && !managedPod(newPod) {
+		return "not_managed"
+	}
+	if oldPod.ResourceVersion == newPod.ResourceVersion {
+		// resync, managed pods are reconciled
+		return ""
+	}
+	if !equalPrefixed(oldPod.Annotations, newPod.Annotations, pkg.PodAnnotationPrefix) ||
+		!equalPrefixed(oldPod.Labels, newPod.Labels, labelPrefix(newPod)) ||
+		oldPod.Status.PodIP != newPod.Status.PodIP ||
+		oldPod.Status.HostIP != newPod.Status.HostIP ||
+		oldPod.Status.Phase != newPod.Status.Phase ||
+		(oldPod.DeletionTimestamp == nil) != (newPod.DeletionTimestamp == nil) {
+		return ""
+	}
+	return "unchanged"
+}
+
+// managedPod returns whether the pod has EIP annotations or controller labels
+func managedPod(pod *v1.Pod) bool {
+	return hasPrefixedKey(pod.Annotations, pkg.PodAnnotationPrefix) || hasPrefixedKey(pod.Labels, pkg.PodLabelPrefix)
+}
+
+// labelPrefix returns the prefix of the labels whose changes are processed, all labels for pods with a tag value template
+func labelPrefix(pod *v1.Pod) string {
+	if _, ok := pod.Annotations[pkg.PodAddressFixedTagValueTemplateAnnotationKey]; ok {
+		return ""
+	}
+	return pkg.PodLabelPrefix
+}
+
+func hasPrefixedKey(m map[string]string, prefix string) bool {
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalPrefixed returns whether both maps have the same keys with the prefix and the same values
+func equalPrefixed(a, b map[string]string, prefix string) bool {
+	count := 0
+	for k, v := range a {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		count++
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	for k := range b {
+		if strings.HasPrefix(k, prefix) {
+			count--
+		}
+	}
+	return count == 0
+}
@@ -0,0 +1,86 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUpdateSkipReason(t *testing.T) {
+	annotations := map[string]string{pkg.PodEIPAnnotationKey: pkg.PodEIPAnnotationValueAuto}
+	managed := func() *v1.Pod {
+		pod := getPod("10.0.0.1", annotations).(*v1.Pod)
+		pod.ResourceVersion = "1"
+		pod.Labels = map[string]string{"app": "test"}
+		pod.Status.Phase = v1.PodRunning
+		return pod
+	}
+	updated := func(pod *v1.Pod, update func(pod *v1.Pod)) *v1.Pod {
+		newPod := pod.DeepCopy()
+		newPod.ResourceVersion = "2"
+		update(newPod)
+		return newPod
+	}
+
+	t.Run("given managed pod when status changes which are not used then update is skipped", func(t *testing.T) {
+		pod := managed()
+		newPod := updated(pod, func(pod *v1.Pod) {
+			pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+			pod.Annotations["other"] = "value"
+			pod.Labels["app"] = "other"
+		})
+
+		assert.Equal(t, "unchanged", updateSkipReason(pod, newPod))
+	})
+
+	t.Run("given managed pod when used fields change then update is processed", func(t *testing.T) {
+		for name, update := range map[string]func(pod *v1.Pod){
+			"annotation": func(pod *v1.Pod) { pod.Annotations[pkg.PodAddressFixedTagAnnotationKey] = "tag" },
+			"label":      func(pod *v1.Pod) { pod.Labels[pkg.PodPublicIPLabel] = "1.1.1.1" },
+			"pod ip":     func(pod *v1.Pod) { pod.Status.PodIP = "10.0.0.2" },
+			"host ip":    func(pod *v1.Pod) { pod.Status.HostIP = "10.0.1.1" },
+			"phase":      func(pod *v1.Pod) { pod.Status.Phase = v1.PodSucceeded },
+			"deletion":   func(pod *v1.Pod) { now := metav1.Now(); pod.DeletionTimestamp = &now },
+		} {
+			pod := managed()
+			assert.Empty(t, updateSkipReason(pod, updated(pod, update)), name)
+		}
+	})
+
+	t.Run("given pod with tag value template when other labels change then update is processed", func(t *testing.T) {
+		pod := getPod("10.0.0.1", map[string]string{
+			pkg.PodEIPAnnotationKey:                          pkg.PodEIPAnnotationValueFixedTagValue,
+			pkg.PodAddressFixedTagValueTemplateAnnotationKey: `{{index .Labels "zone"}}`,
+		}).(*v1.Pod)
+		pod.ResourceVersion = "1"
+		newPod := updated(pod, func(pod *v1.Pod) { pod.Labels = map[string]string{"zone": "a"} })
+
+		assert.Empty(t, updateSkipReason(pod, newPod))
+	})
+
+	t.Run("given managed pod when it is resynced then update is processed", func(t *testing.T) {
+		pod := managed()
+		assert.Empty(t, updateSkipReason(pod, pod))
+	})
+
+	t.Run("given pod without eip annotation or controller labels when it changes then update is skipped", func(t *testing.T) {
+		pod := getPod("10.0.0.1", nil).(*v1.Pod)
+		newPod := updated(pod, func(pod *v1.Pod) { pod.Status.PodIP = "10.0.0.2" })
+
+		assert.Equal(t, "not_managed", updateSkipReason(pod, newPod))
+		assert.Equal(t, "not_managed", updateSkipReason(pod, pod))
+	})
+
+	t.Run("given pod without ip when it changes then update is skipped", func(t *testing.T) {
+		pod := managed()
+		newPod := updated(pod, func(pod *v1.Pod) { pod.Status.PodIP = "" })
+
+		assert.Equal(t, "no_ip", updateSkipReason(pod, newPod))
+	})
+}
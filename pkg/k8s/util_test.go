@@ -10,6 +10,8 @@ import (
 	"time"
 )
 
+const testMaxQueueRetries = 3
+
 var (
 	testKey    = "default/test-pod"
 	noOpLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
@@ -4,76 +4,224 @@
 package k8s
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
-const maxQueueRetries = 3
+const (
+	// InfiniteQueueRetries retries failing items with the queue rate limiter forever, they never move to the dead-letter queue
+	InfiniteQueueRetries = -1
+	// throttled items are retried with their own backoff and do not count towards queue retries
+	throttledBaseDelay = 5 * time.Second
+	throttledMaxDelay  = 5 * time.Minute
+)
+
+// classifiedError is implemented by errors which know if retrying can help
+type classifiedError interface {
+	error
+	Retryable() bool
+	Throttled() bool
+}
 
 type PodHandler interface {
-	AddOrUpdate(key string, pod v1.Pod) error
-	Delete(key string) error
+	AddOrUpdate(ctx context.Context, key string, pod v1.Pod) error
+	Delete(ctx context.Context, key string) error
+	// DeadLetter records on the pod that it is retried on the dead-letter schedule and why
+	DeadLetter(ctx context.Context, key string, attempts int, err error) error
+	// Recovered removes the dead-letter record from the pod
+	Recovered(ctx context.Context, key string) error
+	// Reconcile returns the keys of the pods which need changes, it is called once with all pods after cache sync
+	Reconcile(ctx context.Context, pods []*v1.Pod) ([]string, error)
 }
 
 type worker struct {
 	logger          *slog.Logger
 	maxQueueRetries int
 	handler         PodHandler
+	pending         *pendingPods
+	deadLetter      *deadLetterQueue
+	throttled       workqueue.RateLimiter
+	// slots limits the number of items processed concurrently, nil means unlimited
+	slots chan struct{}
+	// shutdownTimeout is how long in-flight items may take after shutdown before they are cancelled
+	shutdownTimeout time.Duration
 }
 
-func newWorker(logger *slog.Logger, handler PodHandler) *worker {
+func newWorker(logger *slog.Logger, handler PodHandler, pending *pendingPods, deadLetter *deadLetterQueue, maxQueueRetries int, workers int, shutdownTimeout time.Duration) *worker {
+	var slots chan struct{}
+	if workers > 0 {
+		slots = make(chan struct{}, workers)
+	}
 	return &worker{
 		logger:          logger.With("component", "worker"),
 		maxQueueRetries: maxQueueRetries,
 		handler:         handler,
+		pending:         pending,
+		deadLetter:      deadLetter,
+		throttled:       workqueue.NewItemExponentialFailureRateLimiter(throttledBaseDelay, throttledMaxDelay),
+		slots:           slots,
+		shutdownTimeout: shutdownTimeout,
 	}
 }
 
-// run starts processing items from the queue, this call is blocking until queue is shut down
-func (w *worker) run(queue workqueue.RateLimitingInterface, indexer cache.KeyGetter) {
+// run starts processing items from the queue, this call is blocking until queue is shut down. Once ctx is done, items
+// which have not been started are skipped and in-flight items are cancelled after the shutdown timeout.
+func (w *worker) run(ctx context.Context, queue workqueue.RateLimitingInterface, indexer cache.KeyGetter) {
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	go w.cancelOnShutdown(ctx, workCtx, cancel)
+
 	var wg sync.WaitGroup
 	for {
-		// request limit?
+		// wait for a free slot first, so items stay in the queue and are dequeued in the queue order
+		w.acquireSlot()
 		item, shutdown := queue.Get()
 		if shutdown {
+			w.releaseSlot()
 			w.logger.Info("received queue shut down")
 			w.logger.Info("waiting for items to be processed")
 			wg.Wait()
 			w.logger.Info("all items processed")
 			return
 		}
+		if ctx.Err() != nil {
+			// shutting down, the pod is reconciled after restart
+			w.logger.Debug(fmt.Sprintf("shutting down, skipping item %s", item))
+			queue.Done(item)
+			w.releaseSlot()
+			continue
+		}
 
 		wg.Add(1)
 		go func(key interface{}) {
 			// done has to be called when we finished processing the item
 			defer queue.Done(key)
 			defer wg.Done()
+			defer w.releaseSlot()
 
 			retries := queue.NumRequeues(key)
-			if err := w.processItem(indexer, key.(string)); err != nil {
+			err := w.processItem(workCtx, indexer, key.(string))
+			if err != nil && workCtx.Err() != nil {
+				// cancelled on shutdown, neither a failure nor a retry, the queue is shut down and does not take it back
+				w.logger.Info(fmt.Sprintf("process item %s cancelled on shutdown, will be reconciled on restart: %v", key, err))
+				queue.Forget(key)
+				return
+			}
+			var pending pendingError
+			if errors.As(err, &pending) {
+				// the pool is exhausted, retrying does not help, the pod is woken up once an address becomes available
+				w.logger.Info(fmt.Sprintf("process item %s pending on %s pool: %v", key, pending.PendingPool(), err))
+				w.pending.add(pending.PendingPool(), key.(string))
+				w.leaveDeadLetter(workCtx, key.(string))
+				queue.Forget(key)
+				return
+			}
+			if pool, ok := w.pending.remove(key.(string)); ok && err == nil {
+				// the pod got an address from the pool, there might be more available for the next one
+				if next, ok := w.pending.next(pool); ok {
+					w.logger.Debug(fmt.Sprintf("waking up pending item %s on %s pool", next, pool))
+					queue.Add(next)
+				}
+			}
+			var classified classifiedError
+			if errors.As(err, &classified) && classified.Throttled() {
+				delay := w.throttled.When(key)
+				w.logger.Warn(fmt.Sprintf("process item %s throttled, retrying in %s: %v", key, delay, err))
+				queue.AddAfter(key, delay)
+				return
+			}
+			w.throttled.Forget(key)
+			if err != nil {
 				w.logger.Error(fmt.Sprintf("process item: %v", err))
-				if retries < maxQueueRetries {
+				if classified != nil && !classified.Retryable() {
+					// retrying right away does not help, e.g. invalid parameters or missing permissions
+					w.logger.Error(fmt.Sprintf("process item %s failed with non retryable error: %v", key, err))
+					w.addDeadLetter(workCtx, queue, key.(string), err)
+					return
+				}
+				if w.canRetry(retries) && !w.deadLetter.contains(key.(string)) {
 					// calling done in defer, but not forget, we still can retry
-					w.logger.Error(fmt.Sprintf("process item retry %d out of %d, retrying: %v", retries, maxQueueRetries, err))
+					w.logger.Error(fmt.Sprintf("process item retry %d out of %d, retrying: %v", retries, w.maxQueueRetries, err))
 					queue.AddRateLimited(key)
 					return
 				}
-				w.logger.Error(fmt.Sprintf("process item retries exceeded, retried %d out of %d: %v", retries, maxQueueRetries, err))
+				w.logger.Error(fmt.Sprintf("process item retries exceeded, retried %d out of %d: %v", retries, w.maxQueueRetries, err))
+				w.addDeadLetter(workCtx, queue, key.(string), err)
+				return
 			}
+			w.leaveDeadLetter(workCtx, key.(string))
 
-			// if no error occurs, or number of retries exceeded we forget this item, so it does not have any delay when another change happens
+			// if no error occurs we forget this item, so it does not have any delay when another change happens
 			queue.Forget(key)
 		}(item)
 	}
 }
 
+// cancelOnShutdown cancels the in-flight items once the shutdown timeout after ctx is exceeded, unless run returned before
+func (w *worker) cancelOnShutdown(ctx, workCtx context.Context, cancel context.CancelFunc) {
+	select {
+	case <-ctx.Done():
+	case <-workCtx.Done():
+		return
+	}
+	w.logger.Info(fmt.Sprintf("shutting down, in-flight items are cancelled in %s", w.shutdownTimeout))
+	select {
+	case <-time.After(w.shutdownTimeout):
+		w.logger.Warn("shutdown timeout exceeded, cancelling in-flight items")
+		cancel()
+	case <-workCtx.Done():
+	}
+}
+
+func (w *worker) acquireSlot() {
+	if w.slots != nil {
+		w.slots <- struct{}{}
+	}
+}
+
+func (w *worker) releaseSlot() {
+	if w.slots != nil {
+		<-w.slots
+	}
+}
+
+func (w *worker) canRetry(retries int) bool {
+	return w.maxQueueRetries == InfiniteQueueRetries || retries < w.maxQueueRetries
+}
+
+// addDeadLetter moves the key to the dead-letter queue and schedules the next slow retry
+func (w *worker) addDeadLetter(ctx context.Context, queue workqueue.RateLimitingInterface, key string, err error) {
+	item, delay := w.deadLetter.add(key, err)
+	w.logger.Warn(fmt.Sprintf("dead-letter item %s attempt %d, failing since %s, retrying in %s: %v", key, item.Attempts, item.Since.Format(time.RFC3339), delay, err))
+	if err := w.handler.DeadLetter(ctx, key, item.Attempts, err); err != nil {
+		w.logger.Error(fmt.Sprintf("dead-letter item %s: %v", key, err))
+	}
+	// forget resets the queue retries, the dead-letter queue takes over the retry schedule
+	queue.Forget(key)
+	queue.AddAfter(key, delay)
+}
+
+// leaveDeadLetter removes the key from the dead-letter queue once it no longer fails
+func (w *worker) leaveDeadLetter(ctx context.Context, key string) {
+	if !w.deadLetter.remove(key) {
+		return
+	}
+	w.logger.Info(fmt.Sprintf("item %s recovered, removed from dead-letter queue", key))
+	if err := w.handler.Recovered(ctx, key); err != nil {
+		w.logger.Error(fmt.Sprintf("recover item %s: %v", key, err))
+	}
+}
+
 // processItem retrieves object by key from indexer and sends it to handler for processing
-func (w *worker) processItem(indexer cache.KeyGetter, key string) error {
+func (w *worker) processItem(ctx context.Context, indexer cache.KeyGetter, key string) error {
 	var pod v1.Pod
 	obj, exists, err := indexer.GetByKey(key)
 	if err != nil {
@@ -81,9 +229,9 @@ func (w *worker) processItem(indexer cache.KeyGetter, key string) error {
 	}
 	if !exists {
 		w.logger.Debug(fmt.Sprintf("key %s not found in store, calling handler delete", key))
-		return w.handler.Delete(key)
+		return w.handler.Delete(ctx, key)
 	}
 	pod = *obj.(*v1.Pod)
 	w.logger.Debug(fmt.Sprintf("key %s found in store, calling handler add/update", key))
-	return w.handler.AddOrUpdate(key, pod)
+	return w.handler.AddOrUpdate(ctx, key, pod)
 }
@@ -4,7 +4,10 @@
 package k8s
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"k8s.io/api/core/v1"
 	"testing"
@@ -17,17 +20,18 @@ func TestPodWorker_processNextItem(t *testing.T) {
 		worker := newTestWorker(nil)
 		queue := newTestQueue(5, 500)
 		queue.ShutDown()
-		worker.run(queue, nil)
+		worker.run(context.Background(), queue, nil)
 		// test is not blocking and continues
 	})
 
 	t.Run("given pod worker when handler returns error then queue is retried only max times", func(t *testing.T) {
 		indexer := new(KeyGetterMock)
 		// first get plus retries
-		indexer.On("GetByKey", testKey).Return(nil, false, nil).Times(1 + maxQueueRetries)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Times(1 + testMaxQueueRetries)
 		handler := new(HandlerMock)
 		// first delete plus retries
-		handler.On("Delete", testKey).Return(errors.New("test delete failure")).Times(1 + maxQueueRetries)
+		handler.On("Delete", mock.Anything, testKey).Return(errors.New("test delete failure")).Times(1 + testMaxQueueRetries)
+		handler.On("DeadLetter", mock.Anything, testKey, 1, mock.Anything).Return(nil).Once()
 
 		worker := newTestWorker(handler)
 		queue := newTestQueue(5, 100)
@@ -39,15 +43,271 @@ func TestPodWorker_processNextItem(t *testing.T) {
 			queue.ShutDown()
 		}()
 
-		worker.run(queue, indexer)
+		worker.run(context.Background(), queue, indexer)
 		mock.AssertExpectationsForObjects(t)
 	})
+
+	t.Run("given pod worker with infinite retries when handler returns error then item is never moved to dead-letter queue", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil)
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(errors.New("test delete failure"))
+
+		worker := newTestWorker(handler)
+		worker.maxQueueRetries = InfiniteQueueRetries
+		queue := newTestQueue(1, 10)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		assert.Greater(t, len(handler.Calls), 1+testMaxQueueRetries)
+		assert.False(t, worker.deadLetter.contains(testKey))
+	})
+
+	t.Run("given pod worker when retries are exceeded then item is moved to dead-letter queue", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Times(1 + testMaxQueueRetries)
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(errors.New("test delete failure")).Times(1 + testMaxQueueRetries)
+		handler.On("DeadLetter", mock.Anything, testKey, 1, mock.Anything).Return(nil).Once()
+
+		worker := newTestWorker(handler)
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.True(t, worker.deadLetter.contains(testKey))
+		assert.Equal(t, 0, queue.NumRequeues(testKey))
+	})
+
+	t.Run("given dead-letter item when it is processed successfully then it is recovered", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(nil).Once()
+		handler.On("Recovered", mock.Anything, testKey).Return(nil).Once()
+
+		worker := newTestWorker(handler)
+		worker.deadLetter.add(testKey, errors.New("test delete failure"))
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.False(t, worker.deadLetter.contains(testKey))
+	})
+
+	t.Run("given dead-letter item when it fails again then it is not retried by the queue", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(errors.New("test delete failure")).Once()
+		handler.On("DeadLetter", mock.Anything, testKey, 2, mock.Anything).Return(nil).Once()
+
+		worker := newTestWorker(handler)
+		worker.deadLetter.add(testKey, errors.New("test delete failure"))
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.True(t, worker.deadLetter.contains(testKey))
+	})
+
+	t.Run("given pod worker when handler returns non retryable error then item is moved to dead-letter queue without retries", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(fmt.Errorf("disassociate: %w", testClassifiedError{})).Once()
+		handler.On("DeadLetter", mock.Anything, testKey, 1, mock.Anything).Return(nil).Once()
+
+		worker := newTestWorker(handler)
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.True(t, worker.deadLetter.contains(testKey))
+	})
+
+	t.Run("given pod worker when handler returns throttled error then item is retried without counting queue retries", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(testClassifiedError{retryable: true, throttled: true}).Once()
+
+		worker := newTestWorker(handler)
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			// throttled delay is longer than the test, item is not processed again
+			time.Sleep(100 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.Equal(t, 0, queue.NumRequeues(testKey))
+		assert.Equal(t, 1, worker.throttled.NumRequeues(testKey))
+		assert.False(t, worker.deadLetter.contains(testKey))
+	})
+
+	t.Run("given pod worker when handler returns pending error then item is not retried and is pending", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(fmt.Errorf("disassociate: %w", testPendingError{pool: "pool"})).Once()
+
+		worker := newTestWorker(handler)
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.Equal(t, 0, queue.NumRequeues(testKey))
+		key, ok := worker.pending.next("pool")
+		assert.True(t, ok)
+		assert.Equal(t, testKey, key)
+	})
+
+	t.Run("given pending pod when it is processed successfully then next pending pod on the pool is added to queue", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		indexer.On("GetByKey", "default/next-pod").Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		handler.On("Delete", mock.Anything, testKey).Return(nil).Once()
+		// woken up pod is still waiting on the pool
+		handler.On("Delete", mock.Anything, "default/next-pod").Return(testPendingError{pool: "pool"}).Once()
+
+		worker := newTestWorker(handler)
+		worker.pending.add("pool", testKey)
+		worker.pending.add("pool", "default/next-pod")
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(context.Background(), queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		key, _ := worker.pending.next("pool")
+		assert.Equal(t, "default/next-pod", key)
+		assert.Equal(t, 1, worker.pending.len())
+	})
+
+	t.Run("given pod worker when context is done then queued items are not processed", func(t *testing.T) {
+		// indexer and handler are not set, they should not be called after shutdown
+		worker := newTestWorker(nil)
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(ctx, queue, nil)
+		// test is not blocking and continues
+	})
+
+	t.Run("given in-flight item when shutdown timeout is exceeded then it is cancelled without retry", func(t *testing.T) {
+		indexer := new(KeyGetterMock)
+		indexer.On("GetByKey", testKey).Return(nil, false, nil).Once()
+		handler := new(HandlerMock)
+		started := make(chan struct{})
+		handler.On("Delete", mock.Anything, testKey).Run(func(args mock.Arguments) {
+			close(started)
+			<-args.Get(0).(context.Context).Done()
+		}).Return(context.Canceled).Once()
+
+		worker := newTestWorker(handler)
+		worker.shutdownTimeout = 50 * time.Millisecond
+		queue := newTestQueue(5, 100)
+		queue.Add(testKey)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			<-started
+			cancel()
+			time.Sleep(300 * time.Millisecond)
+			queue.ShutDown()
+		}()
+
+		worker.run(ctx, queue, indexer)
+		mock.AssertExpectationsForObjects(t, indexer, handler)
+		assert.Equal(t, 0, queue.NumRequeues(testKey))
+		assert.False(t, worker.deadLetter.contains(testKey))
+	})
 }
 
 // --- helpers ---
 
 func newTestWorker(handler PodHandler) *worker {
-	return newWorker(noOpLogger, handler)
+	return newWorker(noOpLogger, handler, newPendingPods(), newDeadLetterQueue(time.Hour, time.Hour), testMaxQueueRetries, 0, time.Second)
+}
+
+type testClassifiedError struct {
+	retryable bool
+	throttled bool
+}
+
+func (e testClassifiedError) Error() string {
+	return "test classified error"
+}
+
+func (e testClassifiedError) Retryable() bool {
+	return e.retryable
+}
+
+func (e testClassifiedError) Throttled() bool {
+	return e.throttled
+}
+
+type testPendingError struct {
+	pool string
+}
+
+func (e testPendingError) Error() string {
+	return "test pool exhausted"
+}
+
+func (e testPendingError) PendingPool() string {
+	return e.pool
 }
 
 // --- mocks ---
@@ -65,12 +325,27 @@ type HandlerMock struct {
 	mock.Mock
 }
 
-func (m *HandlerMock) AddOrUpdate(key string, pod v1.Pod) error {
-	args := m.Called(key, pod)
+func (m *HandlerMock) AddOrUpdate(ctx context.Context, key string, pod v1.Pod) error {
+	args := m.Called(ctx, key, pod)
 	return args.Error(0)
 }
 
-func (m *HandlerMock) Delete(key string) error {
-	args := m.Called(key)
+func (m *HandlerMock) Delete(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
 	return args.Error(0)
 }
+
+func (m *HandlerMock) DeadLetter(ctx context.Context, key string, attempts int, err error) error {
+	args := m.Called(ctx, key, attempts, err)
+	return args.Error(0)
+}
+
+func (m *HandlerMock) Recovered(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *HandlerMock) Reconcile(ctx context.Context, pods []*v1.Pod) ([]string, error) {
+	args := m.Called(ctx, pods)
+	return args.Get(0).([]string), args.Error(1)
+}
@@ -0,0 +1,34 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package pkg
+
+import (
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// metrics are published by expvar on /debug/vars
+var metrics = expvar.NewMap("aws_pod_eip_controller")
+
+// PublishMetric publishes the value returned by f, an earlier metric with the same name is replaced
+func PublishMetric(name string, f func() any) {
+	metrics.Set(name, expvar.Func(f))
+}
+
+// AddMetric adds delta to the counter with the name
+func AddMetric(name string, delta int64) {
+	metrics.Add(name, delta)
+}
+
+// ServeMetrics starts serving metrics on the address in the background
+func ServeMetrics(logger *slog.Logger, address string) {
+	go func() {
+		logger.Info(fmt.Sprintf("serving metrics on %s/debug/vars", address))
+		if err := http.ListenAndServe(address, nil); err != nil {
+			logger.Error(fmt.Sprintf("serve metrics: %v", err))
+		}
+	}()
+}